@@ -0,0 +1,78 @@
+package promise
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Batcher coalesces individual loads into batch calls, like the DataLoader
+// pattern: keys passed to Load within Window of the first key of a batch are
+// passed to Fn together. A Batcher must not be copied after first use, and is
+// safe for concurrent use.
+type Batcher struct {
+	// Fn loads the values for keys, in the same order.
+	Fn func(keys []interface{}) ([]interface{}, error)
+	// Window is how long keys are buffered before Fn is called.
+	Window time.Duration
+
+	mu      sync.Mutex
+	pending []batchLoad
+}
+
+type batchLoad struct {
+	key     interface{}
+	promise *Promise
+}
+
+// Load returns a promise that resolves with the value Fn returns for key, as
+// a single interface{}. The promise fails if Fn fails or panics, or returns a
+// number of values that differs from the number of keys in the batch.
+func (b *Batcher) Load(key interface{}) *Promise {
+	p := newPromise(simpleCall)
+	p.resultType = []reflect.Type{interfaceType}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, batchLoad{key, p})
+	if len(b.pending) == 1 {
+		time.AfterFunc(b.Window, b.flush)
+	}
+	b.mu.Unlock()
+	return p
+}
+
+// flush calls Fn with the pending keys and settles their promises.
+func (b *Batcher) flush() {
+	b.mu.Lock()
+	loads := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	keys := make([]interface{}, len(loads))
+	for i, load := range loads {
+		keys[i] = load.key
+	}
+	values, err := b.call(keys)
+	if err == nil && len(values) != len(keys) {
+		err = errors.Errorf("batch function returned %d values for %d keys", len(values), len(keys))
+	}
+	for i, load := range loads {
+		if err != nil {
+			load.promise.settle(nil, err)
+			continue
+		}
+		load.promise.settle(interfaceResult(values[i]), nil)
+	}
+}
+
+// call calls Fn, returning a panic as an error.
+func (b *Batcher) call(keys []interface{}) (values []interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(r)
+		}
+	}()
+	return b.Fn(keys)
+}
@@ -0,0 +1,64 @@
+package promise
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatcherCoalescesLoads(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]interface{}
+	b := &Batcher{
+		Window: 10 * time.Millisecond,
+		Fn: func(keys []interface{}) ([]interface{}, error) {
+			mu.Lock()
+			batches = append(batches, keys)
+			mu.Unlock()
+			values := make([]interface{}, len(keys))
+			for i, key := range keys {
+				values[i] = fmt.Sprintf("value %d", key)
+			}
+			return values, nil
+		},
+	}
+
+	promises := make([]*Promise, 5)
+	for i := range promises {
+		promises[i] = b.Load(i)
+	}
+	for i, p := range promises {
+		var value interface{}
+		require.NoError(t, p.Wait(&value))
+		require.Equal(t, fmt.Sprintf("value %d", i), value)
+	}
+	require.Equal(t, [][]interface{}{{0, 1, 2, 3, 4}}, batches)
+
+	// A load after the window starts a new batch
+	require.NoError(t, b.Load(5).Wait(new(interface{})))
+	require.Len(t, batches, 2)
+}
+
+func TestBatcherFailures(t *testing.T) {
+	failures := map[string]func(keys []interface{}) ([]interface{}, error){
+		"failed": func(keys []interface{}) ([]interface{}, error) {
+			return nil, errors.New("failed")
+		},
+		"batch function returned 1 values for 2 keys": func(keys []interface{}) ([]interface{}, error) {
+			return []interface{}{1}, nil
+		},
+		"panicked": func(keys []interface{}) ([]interface{}, error) {
+			panic("panicked")
+		},
+	}
+	for msg, fn := range failures {
+		b := &Batcher{Fn: fn, Window: 10 * time.Millisecond}
+		first, second := b.Load(1), b.Load(2)
+		require.EqualError(t, first.Wait(new(interface{})), "error during promise execution: "+msg)
+		require.EqualError(t, second.Wait(new(interface{})), "error during promise execution: "+msg)
+	}
+}
@@ -0,0 +1,60 @@
+package promise
+
+import (
+	"sync"
+)
+
+// A Cache keeps the promise for a key, and with it the result of its loader,
+// until the key is invalidated. Unlike a Group, which shares a promise only
+// while it is in flight, a Cache keeps returning a resolved promise. The zero
+// value is ready to use and is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	promises map[string]*Promise
+}
+
+// Get returns the promise for key, calling loader in a new promise if there
+// is none. The promise resolves with the value returned by loader as a single
+// interface{}. Concurrent calls share the promise while loader runs. If
+// loader fails, the promise is dropped, so that a later Get calls loader
+// again.
+func (c *Cache) Get(key string, loader func() (interface{}, error)) *Promise {
+	c.mu.Lock()
+	if p, ok := c.promises[key]; ok {
+		if state := p.State(); state == Pending || state == Resolved {
+			c.mu.Unlock()
+			return p
+		}
+	}
+	if c.promises == nil {
+		c.promises = map[string]*Promise{}
+	}
+	p := New(loader)
+	c.promises[key] = p
+	c.mu.Unlock()
+
+	p.onComplete(func(err error) {
+		if err != nil {
+			c.forget(key, p)
+		}
+	})
+	return p
+}
+
+// Invalidate drops the promise for key, so the next call to Get calls its
+// loader again. Callers already holding the promise, including one still in
+// flight, keep it and receive its result.
+func (c *Cache) Invalidate(key string) {
+	c.mu.Lock()
+	delete(c.promises, key)
+	c.mu.Unlock()
+}
+
+// forget drops the promise for key if it is still p.
+func (c *Cache) forget(key string, p *Promise) {
+	c.mu.Lock()
+	if c.promises[key] == p {
+		delete(c.promises, key)
+	}
+	c.mu.Unlock()
+}
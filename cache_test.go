@@ -0,0 +1,76 @@
+package promise
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	var c Cache
+	var loads int32
+	loader := func() (interface{}, error) {
+		return atomic.AddInt32(&loads, 1), nil
+	}
+
+	// Miss
+	var value interface{}
+	require.NoError(t, c.Get("config", loader).Wait(&value))
+	require.Equal(t, int32(1), value)
+
+	// Hit, even once resolved
+	p := c.Get("config", loader)
+	require.Same(t, p, c.Get("config", loader))
+	require.NoError(t, p.Wait(&value))
+	require.Equal(t, int32(1), value)
+	require.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	// Keys are independent
+	require.NoError(t, c.Get("other", loader).Wait(&value))
+	require.Equal(t, int32(2), value)
+
+	// Invalidate, then reload
+	c.Invalidate("config")
+	require.NoError(t, c.Get("config", loader).Wait(&value))
+	require.Equal(t, int32(3), value)
+	require.NoError(t, p.Wait(&value), "holders of the old promise keep its result")
+	require.Equal(t, int32(1), value)
+}
+
+func TestCacheInvalidateWhileLoading(t *testing.T) {
+	var c Cache
+	blocker := make(chan struct{})
+	slow := c.Get("key", func() (interface{}, error) {
+		<-blocker
+		return "stale", nil
+	})
+	c.Invalidate("key")
+	fresh := c.Get("key", func() (interface{}, error) {
+		return "fresh", nil
+	})
+	close(blocker)
+
+	var value interface{}
+	require.NoError(t, slow.Wait(&value))
+	require.Equal(t, "stale", value)
+	require.NoError(t, c.Get("key", nil).Wait(&value))
+	require.Equal(t, "fresh", value)
+	require.Same(t, fresh, c.Get("key", nil))
+}
+
+func TestCacheDropsFailures(t *testing.T) {
+	var c Cache
+	var calls int32
+	loader := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, errors.New("unavailable")
+		}
+		return "loaded", nil
+	}
+	require.Error(t, c.Get("key", loader).Wait(new(interface{})))
+	var value interface{}
+	require.NoError(t, c.Get("key", loader).Wait(&value))
+	require.Equal(t, "loaded", value)
+}
@@ -0,0 +1,66 @@
+package promise
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrCancelled is the error of a promise that was cancelled before it settled.
+var ErrCancelled = errors.New("promise cancelled")
+
+// Cancel fails the promise with ErrCancelled if it has not settled yet, and
+// reports whether it did so.
+//
+// A function that is already running cannot be stopped; it runs to completion
+// but its results are discarded. A function that has not started yet, such as
+// the continuation of a Then whose prior is still pending, is never invoked.
+// Promises chained from a cancelled promise fail with ErrCancelled in turn
+// without running their functions.
+func (p *Promise) Cancel() bool {
+	p.cond.L.Lock()
+	if p.complete {
+		p.cond.L.Unlock()
+		return false
+	}
+	p.err = ErrCancelled
+	p.cancelled = true
+	p.completeAndUnlock()
+	return true
+}
+
+// isComplete reports whether the promise has settled.
+func (p *Promise) isComplete() bool {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	return p.complete
+}
+
+// Settled is the outcome of one of the promises passed to a combinator.
+type Settled struct {
+	// Index is the position of the promise among those passed
+	Index int
+	// Values contains the results of the promise, nil if it failed
+	Values []interface{}
+	// Err is the error Wait would return for the promise
+	Err error
+}
+
+// CancelAndCollect cancels the promise like Cancel and returns the outcomes of
+// the promises passed to it that have settled so far, in the order they were
+// passed, for a promise returned by All, Race, Any or Some. The promises that
+// have not settled keep running. For any other promise it returns nil.
+func (p *Promise) CancelAndCollect() []Settled {
+	p.Cancel()
+	var settled []Settled
+	for i, prior := range p.priors {
+		if !prior.isComplete() {
+			continue
+		}
+		results, err := prior.outcome()
+		s := Settled{Index: i, Err: prior.waitError()}
+		if err == nil {
+			s.Values = interfaces(results)
+		}
+		settled = append(settled, s)
+	}
+	return settled
+}
@@ -0,0 +1,123 @@
+package promise
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelPendingPromise(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	p := New(func() int {
+		<-blocker
+		return 1
+	})
+	require.True(t, p.Cancel())
+	require.False(t, p.Cancel(), "a promise can only be cancelled once")
+
+	var result int
+	err := p.Wait(&result)
+	require.Error(t, err)
+	require.Equal(t, ErrCancelled, errors.Cause(err))
+}
+
+func TestCancelSettledPromise(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	var result int
+	require.NoError(t, p.Wait(&result))
+	require.False(t, p.Cancel())
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, 1, result)
+}
+
+func TestCancelShortCircuitsThen(t *testing.T) {
+	blocker := make(chan struct{})
+	p := New(func() int {
+		<-blocker
+		return 1
+	})
+	var ran int32
+	next := p.Then(func(x int) int {
+		atomic.StoreInt32(&ran, 1)
+		return x
+	})
+	after := next.Then(func(x int) int {
+		atomic.StoreInt32(&ran, 1)
+		return x
+	})
+
+	// Cancelling the running promise fails everything downstream
+	p.Cancel()
+	close(blocker)
+	err := after.Wait(new(int))
+	require.Equal(t, ErrCancelled, errors.Cause(err))
+	require.Equal(t, int32(0), atomic.LoadInt32(&ran), "continuations of a cancelled promise must not run")
+}
+
+func TestCancelPendingContinuation(t *testing.T) {
+	blocker := make(chan struct{})
+	p := New(func() int {
+		<-blocker
+		return 1
+	})
+	var ran int32
+	next := p.Then(func(x int) int {
+		atomic.StoreInt32(&ran, 1)
+		return x
+	})
+	next.Cancel()
+	close(blocker)
+
+	require.NoError(t, p.Wait(new(int)))
+	err := next.Wait(new(int))
+	require.Equal(t, ErrCancelled, errors.Cause(err))
+	require.Equal(t, int32(0), atomic.LoadInt32(&ran), "a cancelled continuation must not run")
+}
+
+func TestCancelAndCollect(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	fast := New(func() int {
+		return 1
+	})
+	failed := New(func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	slow := New(func() int {
+		<-blocker
+		return 3
+	})
+	// Some can still succeed after a single failure
+	some := Some(2, fast, slow, failed)
+	require.NoError(t, fast.Wait(new(int)))
+	require.Error(t, failed.Wait(new(int)))
+
+	settled := some.CancelAndCollect()
+	require.Len(t, settled, 2)
+	require.Equal(t, Settled{Index: 0, Values: []interface{}{1}}, settled[0])
+	require.Equal(t, 2, settled[1].Index)
+	require.Nil(t, settled[1].Values)
+	require.EqualError(t, settled[1].Err, "error during promise execution: failed")
+
+	err := some.Wait(new([]int))
+	require.Equal(t, ErrCancelled, errors.Cause(err))
+
+	all := All(fast, slow)
+	require.Equal(t, []Settled{{Index: 0, Values: []interface{}{1}}}, all.CancelAndCollect())
+	require.Equal(t, ErrCancelled, errors.Cause(all.Wait(new([]int))))
+}
+
+func TestCancelAndCollectNonCombinator(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	p := New(func() {
+		<-blocker
+	})
+	require.Nil(t, p.CancelAndCollect())
+	require.Equal(t, ErrCancelled, errors.Cause(p.Wait()))
+}
@@ -0,0 +1,113 @@
+package promise
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Result is the outcome of a promise delivered over a channel.
+type Result struct {
+	// Values contains the results of the promise, nil if it failed
+	Values []interface{}
+	// Err is the error Wait would return
+	Err error
+}
+
+// Chan returns a channel that receives exactly one Result once the promise
+// settles and is then closed. It may be called before or after the promise
+// completes, and any number of times.
+func (p *Promise) Chan() <-chan Result {
+	ch := make(chan Result, 1)
+	p.OnComplete(func(err error) {
+		result := Result{Err: p.waitError()}
+		if result.Err == nil {
+			result.Values = interfaces(p.results)
+		}
+		ch <- result
+		close(ch)
+	})
+	return ch
+}
+
+// FromChan returns a promise that resolves with the Values of the first Result
+// received from ch as a single []interface{}, or fails with its Err. The
+// promise fails if ch is closed without delivering a Result.
+func FromChan(ch <-chan Result) *Promise {
+	return New(func() ([]interface{}, error) {
+		result, ok := <-ch
+		if !ok {
+			return nil, errors.New("channel closed without a result")
+		}
+		return result.Values, result.Err
+	})
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// interfaceResult returns the results of a promise that resolves with result
+// as a single interface{}.
+func interfaceResult(result interface{}) []reflect.Value {
+	resultRv := reflect.New(interfaceType).Elem()
+	if result != nil {
+		resultRv.Set(reflect.ValueOf(result))
+	}
+	return []reflect.Value{resultRv}
+}
+
+// FromCallback adapts a callback based API. register is called synchronously
+// with a done function, which it passes to the API. The returned promise
+// resolves with the result passed to the first call of done as a single
+// interface{}, or fails with its err. Later calls of done are ignored. If
+// register panics, the promise fails as if the panic occurred in New.
+func FromCallback(register func(done func(result interface{}, err error))) (p *Promise) {
+	p = newPromise(simpleCall)
+	p.resultType = []reflect.Type{interfaceType}
+	done := func(result interface{}, err error) {
+		if err != nil {
+			p.settle(nil, err)
+			return
+		}
+		p.settle(interfaceResult(result), nil)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			p.settle(nil, recovered(r))
+		}
+	}()
+	register(done)
+	return p
+}
+
+// PipeTo returns a promise that sends each result of this Promise to ch, in
+// order, once it completes, and then resolves with those same results, like
+// Tap. ch is not closed, as it belongs to the caller. If this Promise fails,
+// nothing is sent and the returned promise fails the same way.
+//
+// Sends block until ch receives them. If the context of the chain (see
+// NewWithContext) is done while a send is blocked, the remaining results are
+// not sent and the returned promise fails with the error of the context.
+func (p *Promise) PipeTo(ch chan<- interface{}) *Promise {
+	if ch == nil {
+		panic(errors.New("PipeTo requires a non-nil channel"))
+	}
+	var done <-chan struct{}
+	if p.ctx != nil {
+		done = p.ctx.Done()
+	}
+	ctx := p.ctx
+	pipeType := reflect.FuncOf(p.resultType, append(append([]reflect.Type{}, p.resultType...), errorType), false)
+	pipe := reflect.MakeFunc(pipeType, func(results []reflect.Value) []reflect.Value {
+		for _, result := range results {
+			select {
+			case ch <- result.Interface():
+			case <-done:
+				errRv := reflect.New(errorType).Elem()
+				errRv.Set(reflect.ValueOf(ctx.Err()))
+				return append(zeroResults(p.resultType), errRv)
+			}
+		}
+		return append(append([]reflect.Value{}, results...), reflect.Zero(errorType))
+	})
+	return p.Then(pipe.Interface())
+}
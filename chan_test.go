@@ -0,0 +1,157 @@
+package promise
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChanDeliversOneResult(t *testing.T) {
+	p := New(func() (int, string) {
+		return 1, "one"
+	})
+	before := p.Chan()
+	require.NoError(t, p.Wait(new(int), new(string)))
+	after := p.Chan()
+
+	for _, ch := range []<-chan Result{before, after} {
+		result, ok := <-ch
+		require.True(t, ok)
+		require.NoError(t, result.Err)
+		require.Equal(t, []interface{}{1, "one"}, result.Values)
+		_, ok = <-ch
+		require.False(t, ok, "the channel is closed after the result")
+	}
+}
+
+func TestChanDeliversError(t *testing.T) {
+	p := New(func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	result := <-p.Chan()
+	require.EqualError(t, result.Err, "error during promise execution: failed")
+	require.Nil(t, result.Values)
+}
+
+func TestFromChan(t *testing.T) {
+	ch := make(chan Result, 1)
+	p := FromChan(ch)
+	ch <- Result{Values: []interface{}{1, "one"}}
+
+	var values []interface{}
+	require.NoError(t, p.Wait(&values))
+	require.Equal(t, []interface{}{1, "one"}, values)
+}
+
+func TestFromChanErrors(t *testing.T) {
+	ch := make(chan Result, 1)
+	ch <- Result{Err: errors.New("failed")}
+	require.EqualError(t, FromChan(ch).Wait(new([]interface{})), "error during promise execution: failed")
+
+	closed := make(chan Result)
+	close(closed)
+	require.EqualError(t, FromChan(closed).Wait(new([]interface{})), "error during promise execution: channel closed without a result")
+}
+
+// fetchAsync simulates a legacy API reporting its outcome to a callback from
+// another goroutine.
+func fetchAsync(key string, callback func(value interface{}, err error)) {
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		if key == "" {
+			callback(nil, errors.New("empty key"))
+			return
+		}
+		callback("value of "+key, nil)
+	}()
+}
+
+func TestFromCallback(t *testing.T) {
+	p := FromCallback(func(done func(interface{}, error)) {
+		fetchAsync("a", done)
+	})
+	var result interface{}
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, "value of a", result)
+
+	length := p.Then(func(value interface{}) int {
+		return len(value.(string))
+	})
+	var n int
+	require.NoError(t, length.Wait(&n))
+	require.Equal(t, 10, n)
+
+	failing := FromCallback(func(done func(interface{}, error)) {
+		fetchAsync("", done)
+	})
+	require.EqualError(t, failing.Wait(&result), "error during promise execution: empty key")
+}
+
+func TestFromCallbackFirstCallWins(t *testing.T) {
+	p := FromCallback(func(done func(interface{}, error)) {
+		done(nil, nil)
+		done(1, errors.New("ignored"))
+	})
+	var result interface{}
+	require.NoError(t, p.Wait(&result))
+	require.Nil(t, result)
+}
+
+func TestFromCallbackRegisterPanics(t *testing.T) {
+	p := FromCallback(func(done func(interface{}, error)) {
+		panic("failed to register")
+	})
+	require.EqualError(t, p.Wait(new(interface{})), "error during promise execution: failed to register")
+}
+
+func TestPipeTo(t *testing.T) {
+	ch := make(chan interface{}, 2)
+	p := New(func() (int, string) {
+		return 1, "one"
+	}).PipeTo(ch)
+	var n int
+	var s string
+	require.NoError(t, p.Wait(&n, &s))
+	require.Equal(t, 1, n)
+	require.Equal(t, "one", s)
+	require.Equal(t, 1, <-ch)
+	require.Equal(t, "one", <-ch)
+
+	// The channel is left open for more values
+	require.NoError(t, New(func() int {
+		return 2
+	}).PipeTo(ch).Wait(&n))
+	require.Equal(t, 2, <-ch)
+	require.Empty(t, ch)
+
+	failing := New(func() (int, error) {
+		return 0, errors.New("failed")
+	}).PipeTo(ch)
+	require.EqualError(t, failing.Wait(&n), "error during promise execution: failed")
+	require.Empty(t, ch)
+
+	requirePanicsWithError(t, "PipeTo requires a non-nil channel", func() {
+		New(func() {}).PipeTo(nil)
+	})
+}
+
+func TestPipeToBlockedSendRespectsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	unbuffered := make(chan interface{})
+	p := NewWithContext(ctx, func() int {
+		return 1
+	}).PipeTo(unbuffered)
+	time.AfterFunc(10*time.Millisecond, cancel)
+	require.Equal(t, context.Canceled, pkgerrors.Cause(p.Wait(new(int))))
+
+	// Without a context the send blocks until received
+	blocked := New(func() int {
+		return 1
+	}).PipeTo(unbuffered)
+	require.Equal(t, 1, <-unbuffered)
+	require.NoError(t, blocked.Wait(new(int)))
+}
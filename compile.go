@@ -0,0 +1,96 @@
+package promise
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// A Stage is a function in a chain compiled with Compile. Like a function
+// passed to Then, it accepts the results of the previous stage and may return
+// an error as its last value.
+type Stage interface{}
+
+// CompiledChain is a chain of stages validated once by Compile, so that it
+// can be run repeatedly without checking types again.
+type CompiledChain struct {
+	prepared Prepared
+}
+
+// Compile validates that each stage accepts the results of the one before it,
+// like Then would, and returns a chain that runs the stages in sequence. The
+// first stage accepts the arguments passed to Run. Unlike a chain built with
+// New and Then, all of the stages run within a single promise, and a stage
+// that fails or panics skips the rest.
+func Compile(stages ...Stage) *CompiledChain {
+	if len(stages) == 0 {
+		panic(errors.New("Compile requires at least one stage"))
+	}
+	first := prepare("Compile: stage 0", reflect.ValueOf(stages[0]))
+	firstType := first.functionRv.Type()
+	functions := []reflect.Value{first.functionRv}
+	returnsError := []bool{first.returnsError}
+	resultType := first.resultType
+	for i, stage := range stages[1:] {
+		functionRv := reflect.ValueOf(stage)
+		checkNilFunction(fmt.Sprintf("Compile: stage %d", i+1), functionRv)
+		if functionRv.Kind() != reflect.Func {
+			panic(errors.Errorf("stage %d: expected Function, got %v", i+1, functionRv.Kind()))
+		}
+		next, nextReturnsError := getResultType(functionRv.Type())
+		functions = append(functions, checkStage(i+1, resultType, functionRv))
+		returnsError = append(returnsError, nextReturnsError)
+		resultType = next
+	}
+
+	outputs := append(append([]reflect.Type{}, resultType...), errorType)
+	chainType := reflect.FuncOf(first.inputs, outputs, false)
+	chain := reflect.MakeFunc(chainType, func(args []reflect.Value) []reflect.Value {
+		var results []reflect.Value
+		// A variadic first stage takes its variadic arguments as a slice
+		if firstType.IsVariadic() {
+			results = functions[0].CallSlice(args)
+		} else {
+			results = functions[0].Call(args)
+		}
+		for i := range functions {
+			if i > 0 {
+				results = functions[i].Call(results)
+			}
+			if !returnsError[i] {
+				continue
+			}
+			errRv := results[len(results)-1]
+			if !isNilError(errRv) {
+				return append(zeroResults(resultType), errRv)
+			}
+			results = results[:len(results)-1]
+		}
+		return append(results, reflect.Zero(errorType))
+	})
+	return &CompiledChain{prepared: prepare("Compile", chain)}
+}
+
+// checkStage panics unless stage accepts resultType, naming the stage in the
+// error, and returns it adapted like a function passed to Then.
+func checkStage(index int, resultType []reflect.Type, stage reflect.Value) reflect.Value {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok {
+				panic(errors.Wrapf(err, "stage %d", index))
+			}
+			panic(r)
+		}
+	}()
+	return (&Promise{resultType: resultType}).continuation(stage)
+}
+
+// Run returns a promise that resolves with the results of the last stage once
+// the chain, called with args, completes. args are checked like those of
+// Prepared.Call. If the first stage is variadic, its variadic parameter binds
+// to a single slice argument, so that Compile(func(xs ...int) int {...}) is
+// run with Run([]int{1, 2, 3}), not Run(1, 2, 3).
+func (c *CompiledChain) Run(args ...interface{}) *Promise {
+	return c.prepared.Call(args...)
+}
@@ -0,0 +1,106 @@
+package promise
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompile(t *testing.T) {
+	chain := Compile(addInts, func(sum int) (string, error) {
+		return strconv.Itoa(sum), nil
+	}, func(s string) (string, int) {
+		return s + "!", len(s)
+	})
+	for i := 0; i < 3; i++ {
+		var s string
+		var n int
+		require.NoError(t, chain.Run(i, 10).Wait(&s, &n))
+		require.Equal(t, strconv.Itoa(i+10)+"!", s)
+		require.Equal(t, 2, n)
+	}
+}
+
+func TestCompileStopsOnError(t *testing.T) {
+	called := false
+	chain := Compile(func(x int) (int, error) {
+		if x < 0 {
+			return 0, errors.New("negative")
+		}
+		return x, nil
+	}, func(x int) int {
+		called = true
+		return x
+	})
+	var result int
+	require.EqualError(t, chain.Run(-1).Wait(&result), "error during promise execution: negative")
+	require.False(t, called)
+	require.NoError(t, chain.Run(1).Wait(&result))
+	require.Equal(t, 1, result)
+	require.True(t, called)
+}
+
+func TestCompileVariadic(t *testing.T) {
+	chain := Compile(func(xs ...int) (int, int) {
+		return len(xs), xs[0]
+	}, addInts)
+	var result int
+	require.NoError(t, chain.Run([]int{5, 6}).Wait(&result))
+	require.Equal(t, 7, result)
+
+	// Later stages take the results of the previous one like Then would, in
+	// a variadic tail or absorbed into a single slice
+	sum := func(xs []int) int {
+		total := 0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	}
+	pair := func(x int) (int, int) { return x, x + 1 }
+	chain = Compile(pair, func(xs ...int) (int, int, int) {
+		return xs[0], xs[1], len(xs)
+	}, sum)
+	require.NoError(t, chain.Run(3).Wait(&result))
+	require.Equal(t, 9, result)
+	requirePanicsWithError(t, "stage 1: promise returns (int, string), which cannot be absorbed by slice parameter of type []int: result 1 has type string", func() {
+		Compile(func() (int, string) { return 0, "" }, sum)
+	})
+}
+
+func TestCompileValidates(t *testing.T) {
+	requirePanicsWithError(t, "Compile requires at least one stage", func() {
+		Compile()
+	})
+	requirePanicsWithError(t, "stage 1: for argument 0: expected type int got type string", func() {
+		Compile(addInts, func(string) {})
+	})
+	requirePanicsWithError(t, "stage 2: expected Function, got int", func() {
+		Compile(addInts, func(x int) int { return x }, 1)
+	})
+	chain := Compile(addInts)
+	requirePanicsWithError(t, "for argument 1: expected type int got type string", func() {
+		chain.Run(1, "one")
+	})
+}
+
+func BenchmarkCompiledChain(b *testing.B) {
+	b.ReportAllocs()
+	chain := Compile(addInts, strconv.Itoa)
+	for i := 0; i < b.N; i++ {
+		var result string
+		err := chain.Run(i, 1).Wait(&result)
+		require.Nil(b, err)
+	}
+}
+
+func BenchmarkRebuiltChain(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result string
+		err := New(addInts, i, 1).Then(strconv.Itoa).Wait(&result)
+		require.Nil(b, err)
+	}
+}
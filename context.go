@@ -0,0 +1,97 @@
+package promise
+
+import (
+	"context"
+	"reflect"
+)
+
+// NewWithContext is like New, but binds the promise to ctx. If ctx is done
+// before f starts, f is not called and the promise fails with ctx.Err().
+//
+// Promises chained with Then, ThenErr, Tap and their variants inherit ctx, and
+// each one fails with ctx.Err() instead of calling its function if ctx is done
+// when its prior completes. Cancelling ctx therefore stops the rest of a chain;
+// a function that is already running is not interrupted unless it observes
+// ctx itself.
+//
+// If the first parameter of f is a context.Context, ctx is passed there, so
+// that f can observe it, and args are matched against the remaining
+// parameters.
+func NewWithContext(ctx context.Context, f interface{}, args ...interface{}) *Promise {
+	pr := prepare("NewWithContext", reflect.ValueOf(f))
+	if len(pr.inputs) == 0 || pr.inputs[0] != contextType {
+		return pr.call(ctx, args)
+	}
+	rest := pr
+	rest.inputs = pr.inputs[1:]
+	p, argValues := rest.bind(ctx, args)
+	p.start(pr.functionRv, nil, nil, 0, append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, argValues...))
+	return p
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// AllContext is like All, but fails with ctx.Err() as soon as ctx is done, if
+// it has not settled yet. The passed promises keep running in that case, but
+// the goroutines waiting on them for the combinator are released. Promises
+// chained from the returned promise inherit ctx, as with NewWithContext.
+func AllContext(ctx context.Context, promises ...*Promise) *Promise {
+	return combineContext(ctx, All, promises)
+}
+
+// RaceContext is like Race, but fails with ctx.Err() as soon as ctx is done,
+// if it has not settled yet. See AllContext.
+func RaceContext(ctx context.Context, promises ...*Promise) *Promise {
+	return combineContext(ctx, Race, promises)
+}
+
+// AnyContext is like Any, but fails with ctx.Err() as soon as ctx is done, if
+// it has not settled yet. See AllContext.
+func AnyContext(ctx context.Context, promises ...*Promise) *Promise {
+	return combineContext(ctx, Any, promises)
+}
+
+// combineContext combines promises with combine, bounding the combination by
+// ctx. The combinator waits on proxies of the promises rather than on the
+// promises themselves, so that failing the proxies once ctx is done releases
+// its waiters.
+func combineContext(ctx context.Context, combine func(promises ...*Promise) *Promise, promises []*Promise) *Promise {
+	checkPromises(promises)
+	proxies := make([]*Promise, len(promises))
+	for i, prior := range promises {
+		prior := prior
+		proxy := newPromise(simpleCall)
+		proxy.resultType = prior.resultType
+		prior.OnComplete(func(err error) {
+			proxy.settle(prior.results, err)
+		})
+		proxies[i] = proxy
+	}
+	p := combine(proxies...)
+	// Without promises to wait on, the combined promise may already be
+	// running, set ctx under the lock that its call reads it with
+	p.cond.L.Lock()
+	p.ctx = ctx
+	p.cond.L.Unlock()
+	if ctx.Done() == nil {
+		return p
+	}
+	done := make(chan struct{})
+	p.onComplete(func(error) {
+		close(done)
+	})
+	// The watcher only waits for ctx and calls no function, so it does not go
+	// through the Executor: a SyncExecutor would block in Step until ctx is
+	// done
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			p.settle(nil, ctx.Err())
+			for _, proxy := range proxies {
+				proxy.settle(nil, ctx.Err())
+			}
+		}
+	}()
+	return p
+}
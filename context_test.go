@@ -0,0 +1,170 @@
+package promise
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithContext(t *testing.T) {
+	p := NewWithContext(context.Background(), func(x int) int {
+		return x * 2
+	}, 2)
+	var result int
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, 4, result)
+}
+
+func TestNewWithContextAlreadyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var ran int32
+	err := NewWithContext(ctx, func() {
+		atomic.StoreInt32(&ran, 1)
+	}).Wait()
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	require.Equal(t, int32(0), atomic.LoadInt32(&ran))
+}
+
+func TestContextCancelledMidChain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var stages int32
+	stage := func() {
+		atomic.AddInt32(&stages, 1)
+	}
+	first := NewWithContext(ctx, stage)
+	second := first.Then(func() {
+		stage()
+		// Cancel while the second stage is running, it still completes
+		cancel()
+	})
+	third := second.Then(stage)
+	fourth := third.Tap(stage)
+
+	require.NoError(t, second.Wait())
+	err := fourth.Wait()
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	require.Equal(t, int32(2), atomic.LoadInt32(&stages), "stages after the cancellation must not run")
+}
+
+type ctxKey struct{}
+
+func TestNewWithContextInjectsContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	p := NewWithContext(ctx, func(ctx context.Context, x int) (string, int) {
+		return ctx.Value(ctxKey{}).(string), x * 2
+	}, 2)
+	var value string
+	var result int
+	require.NoError(t, p.Wait(&value, &result))
+	require.Equal(t, "value", value)
+	require.Equal(t, 4, result)
+
+	requirePanicsWithError(t, "for argument 0: expected type int got type string", func() {
+		NewWithContext(ctx, func(ctx context.Context, x int) {}, "2")
+	})
+	requirePanicsWithError(t, "expected 1 args, got 2 args", func() {
+		NewWithContext(ctx, func(ctx context.Context, x int) {}, ctx, 2)
+	})
+}
+
+func TestNewWithContextInjectedContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	p := NewWithContext(ctx, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+	cancel()
+	require.Equal(t, context.Canceled, errors.Cause(p.Wait()))
+}
+
+func TestCombinatorsContextCancelled(t *testing.T) {
+	combinators := map[string]func(ctx context.Context, promises ...*Promise) *Promise{
+		"All":  AllContext,
+		"Race": RaceContext,
+		"Any":  AnyContext,
+	}
+	for name, combinator := range combinators {
+		t.Run(name, func(t *testing.T) {
+			blocker := make(chan struct{})
+			defer close(blocker)
+			slow := func() int {
+				<-blocker
+				return 1
+			}
+			before := InFlight()
+			promises := []*Promise{New(slow), New(slow)}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			p := combinator(ctx, promises...)
+			time.AfterFunc(10*time.Millisecond, cancel)
+			start := time.Now()
+			err := p.Wait(new([]int))
+			require.Equal(t, context.Canceled, errors.Cause(err))
+			require.True(t, time.Since(start) < time.Second)
+
+			// The waiters of the combinator are released, only the
+			// passed promises keep running
+			requireEventually(t, func() bool {
+				return InFlight() <= before+int64(len(promises))
+			}, time.Second, time.Millisecond)
+		})
+	}
+}
+
+func TestCombinatorsContextCompleteInTime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	one := func() int {
+		return 1
+	}
+	var results []int
+	require.NoError(t, AllContext(ctx, New(one), New(one)).Wait(&results))
+	require.Equal(t, []int{1, 1}, results)
+	require.NoError(t, RaceContext(ctx, New(one), New(one)).Wait(&results))
+	require.Equal(t, []int{1}, results)
+
+	failing := New(func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	err := AnyContext(context.Background(), failing).Wait(&results)
+	require.IsType(t, &AnyErr{}, errors.Cause(err))
+}
+
+// delayedExecutor runs each function in a new goroutine after a delay.
+type delayedExecutor struct {
+	delay time.Duration
+}
+
+func (e delayedExecutor) Submit(f func()) {
+	go func() {
+		time.Sleep(e.delay)
+		f()
+	}()
+}
+
+func TestCombinatorsContextNoPromises(t *testing.T) {
+	// The combined promise of no promises is already running when its context
+	// is set, which must not race with its function reading it
+	SetExecutor(delayedExecutor{5 * time.Millisecond})
+	defer SetExecutor(nil)
+	combinators := []func(ctx context.Context, promises ...*Promise) *Promise{
+		AllContext, RaceContext, AnyContext,
+	}
+	for _, combine := range combinators {
+		p := combine(context.Background())
+		// Waiting would synchronize with the function through the lock of
+		// the promise, let it run first
+		time.Sleep(20 * time.Millisecond)
+		require.NoError(t, p.Wait())
+	}
+}
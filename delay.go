@@ -0,0 +1,136 @@
+package promise
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// Delay returns a promise that resolves with no values after d has elapsed.
+// It can be chained with Then to schedule follow-up work, or raced against
+// other promises as a time bound. Cancelling the promise releases its timer.
+func Delay(d time.Duration) *Promise {
+	p := newPromise(simpleCall)
+	timer := time.AfterFunc(d, func() {
+		p.settle(nil, nil)
+	})
+	p.onComplete(func(error) {
+		timer.Stop()
+	})
+	return p
+}
+
+// Schedule is like New, but calls f at the wall-clock time at, or right away
+// if at is in the past. Cancelling the promise before then releases its timer
+// and f is never called.
+func Schedule(at time.Time, f interface{}, args ...interface{}) *Promise {
+	pr := prepare("Schedule", reflect.ValueOf(f))
+	p, argValues := pr.bind(nil, args)
+	timer := time.AfterFunc(time.Until(at), func() {
+		p.start(pr.functionRv, nil, nil, 0, argValues)
+	})
+	p.onComplete(func(error) {
+		timer.Stop()
+	})
+	return p
+}
+
+// DelayContext is like Delay, but fails with ctx.Err() if ctx is done before d
+// has elapsed. The underlying timer is released on cancellation, of either ctx
+// or the promise.
+func DelayContext(ctx context.Context, d time.Duration) *Promise {
+	p := newPromise(simpleCall)
+	timer := time.NewTimer(d)
+	stop := make(chan struct{})
+	// The watcher only waits for the timer or ctx and calls no function, so
+	// like the timer of Delay it does not go through the Executor
+	go func() {
+		select {
+		case <-timer.C:
+			p.settle(nil, nil)
+		case <-ctx.Done():
+			p.settle(nil, ctx.Err())
+		case <-stop:
+		}
+	}()
+	p.onComplete(func(error) {
+		timer.Stop()
+		close(stop)
+	})
+	return p
+}
+
+// Timeout returns a promise that settles like this Promise, or fails with
+// ErrTimeout if this Promise does not complete within d. This Promise keeps
+// running in that case.
+func (p *Promise) Timeout(d time.Duration) *Promise {
+	next := p.chain(simpleCall)
+	next.resultType = p.resultType
+	next.returnsError = p.returnsError
+	timer := time.AfterFunc(d, func() {
+		next.settle(nil, ErrTimeout)
+	})
+	p.OnComplete(func(err error) {
+		timer.Stop()
+		next.settle(p.results, err)
+	})
+	return next
+}
+
+// ThenThrottled is like Then, but f is not invoked sooner than minInterval
+// after the function of this Promise was invoked, which caps the rate of
+// polling loops built by chaining. For a promise without a function, such as
+// one returned by All or Delay, the interval is measured from its completion.
+//
+// If the context of the chain (see NewWithContext) is done while waiting for
+// the interval to elapse, f is not invoked and the returned promise fails with
+// the error of the context.
+func (p *Promise) ThenThrottled(minInterval time.Duration, f interface{}) *Promise {
+	functionRv := reflect.ValueOf(f)
+	checkFunction("ThenThrottled", functionRv)
+	ctx := p.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var next *Promise
+	throttled := reflect.MakeFunc(functionRv.Type(), func(args []reflect.Value) []reflect.Value {
+		p.cond.L.Lock()
+		startedAt := p.startedAt
+		p.cond.L.Unlock()
+		if startedAt.IsZero() {
+			startedAt = time.Now()
+		}
+		timer := time.NewTimer(time.Until(startedAt.Add(minInterval)))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			panic(ctx.Err())
+		}
+		// The interval of a following stage counts from now, not from
+		// when the wait began
+		next.cond.L.Lock()
+		next.startedAt = time.Now()
+		next.cond.L.Unlock()
+		return callFunction(functionRv, args)
+	})
+	// next must be assigned before it starts, as throttled refers to it
+	next, throttledRv := p.then(throttled.Interface())
+	next.start(throttledRv, p, nil, 0, nil)
+	return next
+}
+
+// Duration returns how long the function of the promise ran, from when it was
+// invoked until it returned or panicked. Time spent waiting for the promises
+// it depends on, such as the prior of a Then, is not included. It returns 0
+// until the function has returned, and for promises without a function of
+// their own, such as those returned by All, Race, Any, Some, Delay and
+// FromCallback, whose time is spent waiting.
+func (p *Promise) Duration() time.Duration {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	if p.startedAt.IsZero() || p.finishedAt.IsZero() {
+		return 0
+	}
+	return p.finishedAt.Sub(p.startedAt)
+}
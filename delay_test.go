@@ -0,0 +1,178 @@
+package promise
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelayResolvesAfterDuration(t *testing.T) {
+	start := time.Now()
+	err := Delay(50 * time.Millisecond).Wait()
+	require.NoError(t, err)
+	require.True(t, time.Since(start) >= 50*time.Millisecond, "Delay resolved too early")
+}
+
+func TestDelayChainsWithThen(t *testing.T) {
+	p := Delay(time.Millisecond).Then(func() int {
+		return 1
+	})
+	var resolved int
+	err := p.Wait(&resolved)
+	require.NoError(t, err)
+	require.Equal(t, 1, resolved)
+}
+
+func TestDelayContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := DelayContext(ctx, time.Hour)
+	cancel()
+	err := p.Wait()
+	require.Error(t, err)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+}
+
+func TestDelayContextReleasedOnCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	var promises []*Promise
+	for i := 0; i < 10; i++ {
+		promises = append(promises, DelayContext(context.Background(), time.Hour))
+	}
+	for _, p := range promises {
+		require.True(t, p.Cancel())
+	}
+	requireEventually(t, func() bool {
+		return runtime.NumGoroutine() <= before
+	}, time.Second, time.Millisecond)
+}
+
+func TestSchedule(t *testing.T) {
+	at := time.Now().Add(30 * time.Millisecond)
+	p := Schedule(at, func(x int) time.Time {
+		return time.Now()
+	}, 1)
+	require.Equal(t, Pending, p.State())
+	var ranAt time.Time
+	require.NoError(t, p.Wait(&ranAt))
+	require.False(t, ranAt.Before(at), "scheduled function ran early")
+}
+
+func TestScheduleInThePast(t *testing.T) {
+	start := time.Now()
+	var result int
+	require.NoError(t, Schedule(start.Add(-time.Hour), func() int {
+		return 1
+	}).Wait(&result))
+	require.Equal(t, 1, result)
+	require.True(t, time.Since(start) < time.Second)
+}
+
+func TestScheduleCancelled(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	p := Schedule(time.Now().Add(20*time.Millisecond), func() {
+		ran <- struct{}{}
+	})
+	require.True(t, p.Cancel())
+	require.Equal(t, ErrCancelled, errors.Cause(p.Wait()))
+	time.Sleep(40 * time.Millisecond)
+	require.Empty(t, ran, "a cancelled scheduled function must not run")
+
+	delay := Delay(time.Hour)
+	require.True(t, delay.Cancel())
+	require.Equal(t, ErrCancelled, errors.Cause(delay.Wait()))
+}
+
+func TestTimeoutCompletesInTime(t *testing.T) {
+	p := New(func() (int, error) {
+		return 1, nil
+	}).Timeout(time.Second)
+	require.Equal(t, []reflect.Type{reflect.TypeOf(0)}, p.ResultTypes())
+	var result int
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, 1, result)
+
+	failing := New(func() error {
+		return errors.New("failed")
+	}).Timeout(time.Second)
+	require.EqualError(t, failing.Wait(), "error during promise execution: failed")
+}
+
+func TestTimeoutExpires(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	p := New(func() {
+		<-blocker
+	}).Timeout(10 * time.Millisecond)
+	require.Equal(t, ErrTimeout, errors.Cause(p.Wait()))
+}
+
+func TestThenThrottled(t *testing.T) {
+	const interval = 30 * time.Millisecond
+	var starts []time.Time
+	first := New(func() int {
+		starts = append(starts, time.Now())
+		return 1
+	})
+	second := first.ThenThrottled(interval, func(x int) int {
+		starts = append(starts, time.Now())
+		return x + 1
+	})
+	third := second.ThenThrottled(interval, func(x int) int {
+		starts = append(starts, time.Now())
+		return x + 1
+	})
+	var result int
+	require.NoError(t, third.Wait(&result))
+	require.Equal(t, 3, result)
+	require.Len(t, starts, 3)
+	require.True(t, starts[1].Sub(starts[0]) >= interval)
+	require.True(t, starts[2].Sub(starts[1]) >= interval)
+}
+
+func TestThenThrottledAfterCombinator(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	start := time.Now()
+	p := All(New(func() {})).ThenThrottled(interval, func() {})
+	require.NoError(t, p.Wait())
+	require.True(t, time.Since(start) >= interval)
+}
+
+func TestThenThrottledContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	called := false
+	p := NewWithContext(ctx, func() {}).ThenThrottled(time.Hour, func() {
+		called = true
+	})
+	time.AfterFunc(10*time.Millisecond, cancel)
+	require.Equal(t, context.Canceled, errors.Cause(p.Wait()))
+	require.False(t, called)
+}
+
+func TestDuration(t *testing.T) {
+	blocker := make(chan struct{})
+	p := New(func() {
+		<-blocker
+		time.Sleep(20 * time.Millisecond)
+	})
+	// The continuation waits for p, which is not part of its duration
+	next := p.Then(func() {
+		time.Sleep(10 * time.Millisecond)
+	})
+	time.Sleep(30 * time.Millisecond)
+	require.Zero(t, p.Duration(), "the function has not returned yet")
+	close(blocker)
+	require.NoError(t, next.Wait())
+
+	require.True(t, p.Duration() >= 20*time.Millisecond)
+	require.True(t, next.Duration() >= 10*time.Millisecond)
+	require.True(t, next.Duration() < 40*time.Millisecond)
+
+	all := All(p, next)
+	require.NoError(t, all.Wait())
+	require.Zero(t, all.Duration())
+}
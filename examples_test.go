@@ -1,6 +1,7 @@
 package promise
 
 import (
+	"errors"
 	"fmt"
 	"time"
 )
@@ -37,3 +38,63 @@ func ExamplePromise_chain() {
 	}
 	fmt.Println("sixth")
 }
+
+func ExamplePipeline() {
+	p := Pipe(New(func() (string, error) {
+		return "", errors.New("user not found")
+	})).
+		Catch(func(err error) (string, error) {
+			fmt.Println("lookup failed:", err)
+			return "guest", nil
+		}).
+		Then(func(user string) string {
+			return "hello, " + user
+		}).
+		Tap(func(greeting string) {
+			fmt.Println("greeting:", greeting)
+		}).
+		Timeout(time.Second).
+		Build()
+
+	var greeting string
+	if err := p.Wait(&greeting); err != nil {
+		panic(err)
+	}
+	fmt.Println(greeting)
+	// Output:
+	// lookup failed: user not found
+	// greeting: hello, guest
+	// hello, guest
+}
+
+func ExampleSyncExecutor() {
+	e := &SyncExecutor{}
+	SetExecutor(e)
+	defer SetExecutor(nil)
+
+	p := New(func() int {
+		fmt.Println("computing")
+		return 21
+	})
+	doubled := p.Then(func(x int) int {
+		fmt.Println("doubling")
+		return x * 2
+	})
+	fmt.Println("queued:", e.Pending())
+
+	e.Step()
+	fmt.Println("after one step:", p.State(), doubled.State())
+	e.Flush()
+
+	var result int
+	if err := doubled.Wait(&result); err != nil {
+		panic(err)
+	}
+	fmt.Println(result)
+	// Output:
+	// queued: 2
+	// computing
+	// after one step: resolved pending
+	// doubling
+	// 42
+}
@@ -0,0 +1,245 @@
+package promise
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// An Executor runs the work of promises. Every promise, including the waiter
+// goroutines of combinators such as All and the continuations created by Then,
+// is run by submitting a function to the Executor set with SetExecutor. Only
+// timers and the goroutines that watch a context for DelayContext,
+// RetryContext and the combinators bounded by a context, such as AllContext,
+// bypass it, since they call no function and only wait for time to pass.
+//
+// Work submitted for Then and the combinators blocks until the promises it
+// depends on complete. An Executor that bounds concurrency must therefore
+// admit enough work for the promises being waited on to make progress, or it
+// will deadlock.
+type Executor interface {
+	// Submit runs f, typically asynchronously.
+	Submit(f func())
+}
+
+// GoExecutor is the default Executor, it runs every function in a new goroutine.
+type GoExecutor struct{}
+
+// Submit runs f in a new goroutine.
+func (GoExecutor) Submit(f func()) {
+	go f()
+}
+
+type executorHolder struct {
+	executor Executor
+}
+
+var executor atomic.Value
+
+func init() {
+	executor.Store(executorHolder{GoExecutor{}})
+}
+
+// SetExecutor routes the execution of all promises created after the call
+// through e. Passing nil restores the default GoExecutor.
+func SetExecutor(e Executor) {
+	if e == nil {
+		e = GoExecutor{}
+	}
+	executor.Store(executorHolder{e})
+}
+
+func getExecutor() Executor {
+	return executor.Load().(executorHolder).executor
+}
+
+// start submits the work of the promise to the configured Executor, after
+// observing the promise it depends on, if any. The Executor is recorded on the
+// promise the first time it starts, so that all of its work runs under the
+// same one even if SetExecutor is called in between.
+func (p *Promise) start(functionRv reflect.Value, prior *Promise, priors []*Promise, index int, args []reflect.Value) {
+	if prior != nil {
+		prior.observe()
+	}
+	if priors != nil {
+		priors[index].observe()
+	}
+	p.cond.L.Lock()
+	if p.executor == nil {
+		p.executor = getExecutor()
+	}
+	e := p.executor
+	p.cond.L.Unlock()
+	e.Submit(func() {
+		p.run(functionRv, prior, priors, index, args)
+	})
+}
+
+// weightedPool is the Executor returned by NewWeightedPool.
+type weightedPool struct {
+	mu     sync.Mutex
+	cond   sync.Cond
+	budget int64
+	used   int64
+}
+
+// NewWeightedPool returns an Executor that runs the functions of promises
+// while their total weight, set with NewWeighted or WithWeight, stays within
+// budget; a function that does not fit blocks until enough of the budget is
+// released. The weight of a function heavier than the whole budget is capped
+// to it, so it runs alone.
+//
+// Only functions count against the budget, while they run: waiting on other
+// promises, as the continuations of Then and the waiters of combinators do,
+// takes none, so the pool does not deadlock on chains. The pool bounds weight,
+// not goroutines: Submit starts a goroutine for all work right away, and
+// those of functions that do not fit wait in it for the budget.
+func NewWeightedPool(budget int64) Executor {
+	if budget < 1 {
+		panic(errors.Errorf("NewWeightedPool requires a positive budget, got %d", budget))
+	}
+	pool := &weightedPool{budget: budget}
+	pool.cond.L = &pool.mu
+	return pool
+}
+
+// Submit runs f in a new goroutine. The budget is not taken here but by the
+// promise once its function is about to be called, so that the work of a
+// continuation takes none while it waits on the promise before it.
+func (pool *weightedPool) Submit(f func()) {
+	go f()
+}
+
+// acquire blocks until weight fits within the budget and takes it, returning
+// the weight taken.
+func (pool *weightedPool) acquire(weight int64) int64 {
+	if weight > pool.budget {
+		weight = pool.budget
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for pool.used+weight > pool.budget {
+		pool.cond.Wait()
+	}
+	pool.used += weight
+	return weight
+}
+
+// release returns weight to the budget.
+func (pool *weightedPool) release(weight int64) {
+	pool.mu.Lock()
+	pool.used -= weight
+	pool.mu.Unlock()
+	pool.cond.Broadcast()
+}
+
+// NewWeighted is like New, but the function of the promise takes weight of
+// the budget of a pool created by NewWeightedPool while it runs, instead of
+// 1. The weight is ignored by other executors. See WithWeight for promises
+// that do not start right away.
+func NewWeighted(weight int64, f interface{}, args ...interface{}) *Promise {
+	if weight < 1 {
+		panic(errors.Errorf("weight must be positive, got %d", weight))
+	}
+	pr := prepare("NewWeighted", reflect.ValueOf(f))
+	p, argValues := pr.bind(nil, args)
+	p.weight = weight
+	p.start(pr.functionRv, nil, nil, 0, argValues)
+	return p
+}
+
+// WithWeight sets the share of the budget of a pool created by
+// NewWeightedPool that the function of the promise takes while it runs, 1 by
+// default. It returns the promise for chaining.
+//
+// The weight must be set before the function starts, so it suits promises
+// whose function waits on something else: continuations, such as those
+// created by Then or ThenErr, of a promise that has not completed yet, and
+// promises created by NewLazy before they are used. Use NewWeighted for a
+// promise that starts right away. WithWeight panics if the function has
+// already started. Promises without a function, such as those returned by All,
+// take none of the budget.
+func (p *Promise) WithWeight(weight int64) *Promise {
+	if weight < 1 {
+		panic(errors.Errorf("weight must be positive, got %d", weight))
+	}
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	if p.weighed {
+		panic(errors.New("WithWeight: the function of the promise has already started"))
+	}
+	p.weight = weight
+	return p
+}
+
+// poolWeight returns the pool the promise was submitted to and its weight,
+// see WithWeight, or nil if it was submitted to another Executor. The weight
+// can no longer be changed afterwards.
+func (p *Promise) poolWeight() (*weightedPool, int64) {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	p.weighed = true
+	pool, _ := p.executor.(*weightedPool)
+	if p.weight == 0 {
+		return pool, 1
+	}
+	return pool, p.weight
+}
+
+// SyncExecutor is an Executor for deterministic tests: Submit only queues
+// work, which runs synchronously, in submission order, when Step or Flush is
+// called. The zero value is ready to use.
+//
+// Timers and context watchers do not go through the Executor (see Executor),
+// so a promise waiting on a timer, such as one returned by Delay, or on a
+// context settles on its own rather than when stepped.
+//
+// Work that waits on a promise, such as the continuation of a Then, blocks
+// the caller of Step until that promise completes. Since queued work only
+// runs when stepped, a function must not wait on a promise whose work is
+// queued after its own, or it deadlocks.
+type SyncExecutor struct {
+	mu    sync.Mutex
+	queue []func()
+}
+
+// Submit queues f.
+func (e *SyncExecutor) Submit(f func()) {
+	e.mu.Lock()
+	e.queue = append(e.queue, f)
+	e.mu.Unlock()
+}
+
+// Step runs the oldest queued work, if any, and reports whether it did.
+func (e *SyncExecutor) Step() bool {
+	e.mu.Lock()
+	if len(e.queue) == 0 {
+		e.mu.Unlock()
+		return false
+	}
+	f := e.queue[0]
+	e.queue[0] = nil
+	e.queue = e.queue[1:]
+	e.mu.Unlock()
+	f()
+	return true
+}
+
+// Flush runs queued work until none is left, including work queued while it
+// runs, and returns how many pieces of work it ran.
+func (e *SyncExecutor) Flush() int {
+	n := 0
+	for e.Step() {
+		n++
+	}
+	return n
+}
+
+// Pending returns the number of pieces of work queued.
+func (e *SyncExecutor) Pending() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.queue)
+}
@@ -0,0 +1,179 @@
+package promise
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type countingExecutor struct {
+	submitted int64
+}
+
+func (e *countingExecutor) Submit(f func()) {
+	atomic.AddInt64(&e.submitted, 1)
+	go f()
+}
+
+func TestSetExecutorRoutesExecution(t *testing.T) {
+	e := &countingExecutor{}
+	SetExecutor(e)
+	defer SetExecutor(nil)
+
+	one := New(func() int {
+		return 1
+	})
+	two := one.Then(func(x int) int {
+		return x * 2
+	})
+	all := All(one, two)
+
+	var x, y int
+	err := all.Wait(&x, &y)
+	require.NoError(t, err)
+	require.Equal(t, 1, x)
+	require.Equal(t, 2, y)
+	// New, Then and one waiter per promise passed to All
+	require.Equal(t, int64(4), atomic.LoadInt64(&e.submitted))
+}
+
+func TestSetExecutorNilRestoresDefault(t *testing.T) {
+	SetExecutor(&countingExecutor{})
+	SetExecutor(nil)
+	require.Equal(t, GoExecutor{}, getExecutor())
+}
+
+func TestWeightedPool(t *testing.T) {
+	SetExecutor(NewWeightedPool(4))
+	defer SetExecutor(nil)
+
+	var used, peak int64
+	work := func(weight int64) func() {
+		return func() {
+			now := atomic.AddInt64(&used, weight)
+			for {
+				old := atomic.LoadInt64(&peak)
+				if now <= old || atomic.CompareAndSwapInt64(&peak, old, now) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt64(&used, -weight)
+		}
+	}
+	var promises []*Promise
+	for i := 0; i < 20; i++ {
+		weight := int64(1 + i%3)
+		promises = append(promises, NewWeighted(weight, work(weight)))
+	}
+	// Heavier than the whole budget, it runs alone
+	promises = append(promises, NewWeighted(10, work(4)))
+	// Unweighted promises count as 1, and chains over them do not deadlock
+	promises = append(promises, New(work(1)).Then(work(1)))
+	// Continuations and lazy promises are weighted before they start
+	gate := make(chan struct{})
+	prior := New(func() { <-gate })
+	for i := 0; i < 4; i++ {
+		promises = append(promises, prior.Then(work(3)).WithWeight(3))
+		promises = append(promises, prior.ThenErr(func(err error) {
+			work(3)()
+		}).WithWeight(3))
+	}
+	promises = append(promises, NewLazy(work(4)).WithWeight(4))
+	close(gate)
+	require.NoError(t, All(promises...).Wait())
+	require.True(t, atomic.LoadInt64(&peak) <= 4, "peak weight %d exceeds the budget", atomic.LoadInt64(&peak))
+}
+
+func TestWeightedPoolRecordedAtStart(t *testing.T) {
+	SetExecutor(NewWeightedPool(1))
+	release := make(chan struct{})
+	started := make(chan struct{})
+	holder := NewWeighted(1, func() {
+		close(started)
+		<-release
+	})
+	<-started
+	waiting := New(func() {})
+	// The promise was submitted to the pool, so it still waits for the
+	// budget after the executor is replaced
+	SetExecutor(nil)
+	select {
+	case <-waiting.doneChan():
+		t.Fatal("promise ran while the budget was taken")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	require.NoError(t, All(holder, waiting).Wait())
+}
+
+func TestWeightedPoolValidates(t *testing.T) {
+	requirePanicsWithError(t, "NewWeightedPool requires a positive budget, got 0", func() {
+		NewWeightedPool(0)
+	})
+	requirePanicsWithError(t, "weight must be positive, got 0", func() {
+		NewWeighted(0, func() {})
+	})
+	requirePanicsWithError(t, "weight must be positive, got 0", func() {
+		NewLazy(func() {}).WithWeight(0)
+	})
+	started := New(func() {})
+	require.NoError(t, started.Wait())
+	requirePanicsWithError(t, "WithWeight: the function of the promise has already started", func() {
+		started.WithWeight(2)
+	})
+	requirePanicsWithError(t, "NewWeighted: function argument is nil", func() {
+		NewWeighted(1, nil)
+	})
+}
+
+func TestSyncExecutorOrdering(t *testing.T) {
+	e := &SyncExecutor{}
+	SetExecutor(e)
+	defer SetExecutor(nil)
+
+	var order []string
+	record := func(name string) func() {
+		return func() {
+			order = append(order, name)
+		}
+	}
+	first := New(record("first"))
+	second := New(record("second"))
+	all := All(first, second).Then(record("all"))
+	first.Then(record("then"))
+	require.Empty(t, order, "nothing runs until stepped")
+
+	require.True(t, e.Step())
+	require.Equal(t, []string{"first"}, order)
+	// Work runs in submission order: second, the two waiters of All, the
+	// continuation of All and then the continuation of first
+	require.Equal(t, 5, e.Flush())
+	require.Equal(t, []string{"first", "second", "all", "then"}, order)
+	require.False(t, e.Step())
+	require.NoError(t, all.Wait())
+}
+
+func TestSyncExecutorDrivesRetryContext(t *testing.T) {
+	e := &SyncExecutor{}
+	SetExecutor(e)
+	defer SetExecutor(nil)
+
+	calls := 0
+	p := RetryContext(context.Background(), 3, time.Second, func() (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, errors.New("failed")
+		}
+		return calls, nil
+	})
+	require.Equal(t, 3, e.Flush())
+	require.Equal(t, Resolved, p.State())
+	var result int
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, 3, result)
+}
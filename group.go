@@ -0,0 +1,64 @@
+package promise
+
+import (
+	"sync"
+	"time"
+)
+
+// A Group deduplicates concurrent calls by key: while a promise for a key is
+// in flight, Do returns that same promise instead of calling the function
+// again. The zero value is ready to use and is safe for concurrent use.
+type Group struct {
+	// TTL is how long a completed promise keeps being returned for its key.
+	// With the default of zero only in-flight promises are shared.
+	TTL time.Duration
+
+	mu       sync.Mutex
+	promises map[string]*Promise
+}
+
+// Do returns the promise for key if one is in flight (or completed less than
+// TTL ago), otherwise it calls New(f, args...) and shares the new promise
+// with later callers.
+func (g *Group) Do(key string, f interface{}, args ...interface{}) *Promise {
+	g.mu.Lock()
+	if p, ok := g.promises[key]; ok {
+		g.mu.Unlock()
+		return p
+	}
+	if g.promises == nil {
+		g.promises = map[string]*Promise{}
+	}
+	p := New(f, args...)
+	g.promises[key] = p
+	ttl := g.TTL
+	g.mu.Unlock()
+
+	p.onComplete(func(error) {
+		if ttl <= 0 {
+			g.forget(key, p)
+			return
+		}
+		time.AfterFunc(ttl, func() {
+			g.forget(key, p)
+		})
+	})
+	return p
+}
+
+// Forget drops the promise for key, so the next call to Do calls its function
+// again even if the promise is still in flight.
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.promises, key)
+	g.mu.Unlock()
+}
+
+// forget drops the promise for key if it is still p.
+func (g *Group) forget(key string, p *Promise) {
+	g.mu.Lock()
+	if g.promises[key] == p {
+		delete(g.promises, key)
+	}
+	g.mu.Unlock()
+}
@@ -0,0 +1,78 @@
+package promise
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupDedupesInFlightCalls(t *testing.T) {
+	var g Group
+	var calls int32
+	blocker := make(chan struct{})
+	load := func(x int) int {
+		atomic.AddInt32(&calls, 1)
+		<-blocker
+		return x
+	}
+
+	var wg sync.WaitGroup
+	promises := make([]*Promise, 10)
+	for i := range promises {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			promises[i] = g.Do("key", load, 1)
+		}(i)
+	}
+	wg.Wait()
+	close(blocker)
+
+	for _, p := range promises {
+		var result int
+		require.NoError(t, p.Wait(&result))
+		require.Equal(t, 1, result)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGroupWithoutTTLCallsAgainAfterCompletion(t *testing.T) {
+	var g Group
+	var calls int32
+	load := func() {
+		atomic.AddInt32(&calls, 1)
+	}
+	require.NoError(t, g.Do("key", load).Wait())
+	// The promise is forgotten by a callback after it settles
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, g.Do("key", load).Wait())
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestGroupTTLCachesCompletedPromises(t *testing.T) {
+	g := Group{TTL: 50 * time.Millisecond}
+	var calls int32
+	load := func() {
+		atomic.AddInt32(&calls, 1)
+	}
+	first := g.Do("key", load)
+	require.NoError(t, first.Wait())
+	require.True(t, first == g.Do("key", load), "a completed promise is shared within the TTL")
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, g.Do("key", load).Wait())
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestGroupForget(t *testing.T) {
+	g := Group{TTL: time.Hour}
+	first := g.Do("key", func() {})
+	g.Forget("key")
+	second := g.Do("key", func() {})
+	require.False(t, first == second)
+	require.NoError(t, first.Wait())
+	require.NoError(t, second.Wait())
+}
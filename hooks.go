@@ -0,0 +1,309 @@
+package promise
+
+import (
+	"context"
+	"reflect"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A Tracer is called with the name of a promise right before its function is
+// invoked. The returned function is called with the final error of the
+// promise (nil on success) once it settles.
+type Tracer func(name string) (end func(err error))
+
+type tracerHolder struct {
+	tracer Tracer
+}
+
+var tracer atomic.Value
+
+func init() {
+	tracer.Store(tracerHolder{})
+}
+
+// SetTracer sets a hook to wrap the execution of every promise function in a
+// span, for instance an OpenTelemetry span. start is called with the name of the
+// promise (see WithName) before its function is invoked in New, Then, ThenErr
+// or Tap; combinators such as All have no function of their own and are not
+// traced. Passing nil removes the tracer.
+func SetTracer(start func(name string) (end func(err error))) {
+	tracer.Store(tracerHolder{start})
+}
+
+type slowHolder struct {
+	threshold time.Duration
+	log       func(name string, elapsed time.Duration)
+}
+
+var slow atomic.Value
+
+func init() {
+	slow.Store(slowHolder{})
+}
+
+// SetSlowThreshold sets a hook that is called with the name of a promise (see
+// WithName) and the time its function took, whenever that exceeds d. Only the
+// function call itself is timed, not the time spent waiting for the promises
+// it depends on. Passing a nil log removes the hook.
+func SetSlowThreshold(d time.Duration, log func(name string, elapsed time.Duration)) {
+	slow.Store(slowHolder{threshold: d, log: log})
+}
+
+type watchdogHolder struct {
+	threshold time.Duration
+	warn      func(name string, waited time.Duration)
+}
+
+var watchdog atomic.Value
+
+func init() {
+	watchdog.Store(watchdogHolder{})
+}
+
+// SetWatchdog sets a hook that is called with the name of a promise (see
+// WithName) and d whenever a call to Wait or one of its variants has been
+// blocked on the promise for longer than d. A function that waits on a promise
+// chained from its own promise deadlocks silently; the watchdog surfaces such
+// hangs. Passing a nil warn removes the hook.
+func SetWatchdog(d time.Duration, warn func(name string, waited time.Duration)) {
+	watchdog.Store(watchdogHolder{threshold: d, warn: warn})
+}
+
+// watch starts the watchdog, if any, for a wait on the promise and returns a
+// function that stops it.
+func (p *Promise) watch() (stop func()) {
+	w := watchdog.Load().(watchdogHolder)
+	if w.warn == nil {
+		return func() {}
+	}
+	timer := time.AfterFunc(w.threshold, func() {
+		w.warn(p.Name(), w.threshold)
+	})
+	return func() {
+		timer.Stop()
+	}
+}
+
+type errorWrapperHolder struct {
+	wrap func(err error, msg string) error
+}
+
+var errorWrapper atomic.Value
+
+func init() {
+	errorWrapper.Store(errorWrapperHolder{errors.Wrap})
+}
+
+// SetErrorWrapper replaces the function used to add context to errors, such
+// as the "error during promise execution" message added by Wait, for instance
+// with one based on fmt.Errorf and %w. The default is errors.Wrap of
+// github.com/pkg/errors. Passing nil restores the default.
+func SetErrorWrapper(wrap func(err error, msg string) error) {
+	if wrap == nil {
+		wrap = errors.Wrap
+	}
+	errorWrapper.Store(errorWrapperHolder{wrap})
+}
+
+// wrapError adds msg to err with the configured error wrapper.
+func wrapError(err error, msg string) error {
+	return errorWrapper.Load().(errorWrapperHolder).wrap(err, msg)
+}
+
+// maxChainDepth is the limit set with SetMaxChainDepth, or 0
+var maxChainDepth int64
+
+// SetMaxChainDepth limits how long chains of continuations can grow, as a
+// guard against a runaway loop creating a chain that exhausts memory. Then
+// and its variants panic when the continuation they create would be more than
+// n steps away from the promise that started the chain. Combinators such as
+// All start a new chain. Passing 0 removes the limit.
+func SetMaxChainDepth(n int) {
+	atomic.StoreInt64(&maxChainDepth, int64(n))
+}
+
+// inFlight is the number of promise executions in progress, see InFlight
+var inFlight int64
+
+type inFlightHolder struct {
+	hook func(n int64)
+}
+
+var inFlightHook atomic.Value
+
+func init() {
+	inFlightHook.Store(inFlightHolder{})
+}
+
+// InFlight returns the number of promise executions currently in progress.
+//
+// An execution is counted from the moment the Executor runs it until the
+// promise settles. This includes the function of each New, and each
+// continuation created by Then, ThenErr or Tap while it waits for the promise
+// it depends on. Combinators such as All count once per passed promise for
+// as long as they wait on it. Promises settled by a timer, such as Delay, are
+// not counted.
+func InFlight() int64 {
+	return atomic.LoadInt64(&inFlight)
+}
+
+// SetInFlightHook sets a hook that is called with the new value of InFlight
+// whenever it changes, for instance to update a gauge. The hook is called
+// concurrently from the goroutines running promises, so consecutive values
+// may be observed out of order. Passing nil removes the hook.
+func SetInFlightHook(hook func(n int64)) {
+	inFlightHook.Store(inFlightHolder{hook})
+}
+
+// addInFlight adds delta to InFlight and calls the hook, if any.
+func addInFlight(delta int64) {
+	n := atomic.AddInt64(&inFlight, delta)
+	if hook := inFlightHook.Load().(inFlightHolder).hook; hook != nil {
+		hook(n)
+	}
+}
+
+// profilerLabels is non-zero if promise functions run with pprof labels
+var profilerLabels int32
+
+// SetProfilerLabels enables or disables pprof labels for promise functions.
+// When enabled, each function runs with a "promise_id" label holding the ID
+// of its promise and, if the promise has a name (see WithName), a
+// "promise_name" label, so goroutine and CPU profiles attribute work to
+// specific promises. It is disabled by default to avoid the overhead.
+func SetProfilerLabels(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&profilerLabels, value)
+}
+
+// labels returns the pprof labels for the promise
+func (p *Promise) labels() pprof.LabelSet {
+	id := strconv.FormatUint(p.id, 10)
+	if name := p.Name(); name != "" {
+		return pprof.Labels("promise_id", id, "promise_name", name)
+	}
+	return pprof.Labels("promise_id", id)
+}
+
+// finish records the time the function of the promise returned
+func (p *Promise) finish() {
+	p.cond.L.Lock()
+	p.finishedAt = time.Now()
+	p.cond.L.Unlock()
+}
+
+// call invokes the function of the promise, wrapped in a span if a tracer is set
+func (p *Promise) call(functionRv reflect.Value, args []reflect.Value) []reflect.Value {
+	if pool, weight := p.poolWeight(); pool != nil {
+		weight = pool.acquire(weight)
+		defer pool.release(weight)
+	}
+	p.cond.L.Lock()
+	if p.complete {
+		p.cond.L.Unlock()
+		// The promise was cancelled before its function started. Unwind
+		// run without invoking it, settle ignores the panic.
+		panic(ErrCancelled)
+	}
+	p.startedAt = time.Now()
+	name := p.name
+	ctx := p.ctx
+	p.cond.L.Unlock()
+	p.emit(EventStarted, name, Pending, Pending)
+	defer p.finish()
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			// The context of the chain is done, skip the function
+			panic(err)
+		}
+	}
+	if start := tracer.Load().(tracerHolder).tracer; start != nil {
+		if end := start(p.Name()); end != nil {
+			p.onComplete(end)
+		}
+	}
+	if slow := slow.Load().(slowHolder); slow.log != nil {
+		start := time.Now()
+		defer func() {
+			if elapsed := time.Since(start); elapsed > slow.threshold {
+				slow.log(p.Name(), elapsed)
+			}
+		}()
+	}
+	if atomic.LoadInt32(&profilerLabels) != 0 {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var results []reflect.Value
+		pprof.Do(ctx, p.labels(), func(context.Context) {
+			results = functionRv.Call(args)
+		})
+		return results
+	}
+	return functionRv.Call(args)
+}
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// EventCreated is emitted when a promise is created
+	EventCreated EventKind = iota
+	// EventStarted is emitted right before the function of a promise is
+	// invoked; combinators such as All have no function and emit none
+	EventStarted
+	// EventSettled is emitted when a promise settles, before the callbacks
+	// registered with OnComplete are called
+	EventSettled
+)
+
+// An Event describes a step in the life of a promise, see SetObserver.
+type Event struct {
+	Kind EventKind
+	// ID is the ID of the promise, see Promise.ID
+	ID uint64
+	// Name is the name of the promise, see WithName. It is always empty for
+	// EventCreated, as the name can only be set afterwards.
+	Name string
+	// From and To are the states of the promise before and after the event.
+	// They differ only for EventSettled.
+	From, To State
+	// At is when the event occurred
+	At time.Time
+}
+
+type observerHolder struct {
+	observe func(event Event)
+}
+
+var observer atomic.Value
+
+func init() {
+	observer.Store(observerHolder{})
+}
+
+// SetObserver sets a hook that is called with an Event when any promise is
+// created, starts its function or settles, for instance to draw the graph of
+// promises. The hook is called synchronously and concurrently from the
+// goroutines involved, so it must be fast and safe for concurrent use. The
+// events of a promise are observed in order, but those of different promises
+// may interleave: a continuation may start before the EventSettled of its
+// prior is observed. Passing nil removes the hook.
+func SetObserver(observe func(event Event)) {
+	observer.Store(observerHolder{observe})
+}
+
+// emit calls the observer, if any, with an event for the promise.
+func (p *Promise) emit(kind EventKind, name string, from, to State) {
+	if observe := observer.Load().(observerHolder).observe; observe != nil {
+		observe(Event{Kind: kind, ID: p.id, Name: name, From: from, To: to, At: time.Now()})
+	}
+}
@@ -0,0 +1,323 @@
+package promise
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type span struct {
+	name string
+	err  error
+}
+
+func TestSetTracer(t *testing.T) {
+	spans := make(chan span, 1)
+	SetTracer(func(name string) func(err error) {
+		if name != "traced" {
+			// Only trace the promise under test
+			return nil
+		}
+		return func(err error) {
+			spans <- span{name: name, err: err}
+		}
+	})
+	defer SetTracer(nil)
+
+	blocker := make(chan struct{})
+	failed := errors.New("failed")
+	p := New(func() {
+		<-blocker
+	})
+	// The continuation only starts once p completes, after it is named
+	next := p.Then(func() error {
+		return failed
+	}).WithName("traced")
+	close(blocker)
+	require.Error(t, next.Wait())
+
+	select {
+	case s := <-spans:
+		require.Equal(t, span{name: "traced", err: failed}, s)
+	case <-time.After(time.Second):
+		t.Fatal("span was not ended")
+	}
+}
+
+type slowCall struct {
+	name    string
+	elapsed time.Duration
+}
+
+func TestSetSlowThreshold(t *testing.T) {
+	slowCalls := make(chan slowCall, 10)
+	SetSlowThreshold(20*time.Millisecond, func(name string, elapsed time.Duration) {
+		slowCalls <- slowCall{name: name, elapsed: elapsed}
+	})
+	defer SetSlowThreshold(0, nil)
+
+	blocker := make(chan struct{})
+	p := New(func() {
+		<-blocker
+	})
+	// Waiting for p is not counted against the continuations
+	fast := p.Then(func() {}).WithName("fast")
+	slow := p.Then(func() {
+		time.Sleep(30 * time.Millisecond)
+	}).WithName("slow")
+	time.Sleep(30 * time.Millisecond)
+	close(blocker)
+	require.NoError(t, fast.Wait())
+	require.NoError(t, slow.Wait())
+
+	// p itself was slow too, since it was blocked inside its function
+	names := []string{}
+	for i := 0; i < 2; i++ {
+		select {
+		case call := <-slowCalls:
+			require.True(t, call.elapsed >= 20*time.Millisecond)
+			names = append(names, call.name)
+		case <-time.After(time.Second):
+			t.Fatal("slow promise was not logged")
+		}
+	}
+	require.ElementsMatch(t, []string{"", "slow"}, names)
+	require.Len(t, slowCalls, 0)
+}
+
+func TestSetProfilerLabels(t *testing.T) {
+	SetProfilerLabels(true)
+	defer SetProfilerLabels(false)
+
+	blocker := make(chan struct{})
+	p := New(func() {
+		<-blocker
+	})
+	profile := make(chan string, 1)
+	next := p.Then(func() {
+		var buf bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&buf, 1)
+		profile <- buf.String()
+	}).WithName("labelled")
+	close(blocker)
+	require.NoError(t, next.Wait())
+
+	// The running goroutine is attributed to the promise in the profile
+	require.Contains(t, <-profile, fmt.Sprintf(`"promise_id":"%d", "promise_name":"labelled"`, next.ID()))
+}
+
+func TestInFlight(t *testing.T) {
+	const n = 5
+	// Other tests may leave promises running, such as the never ending
+	// promise of TestAllReturnsIfAnyFails
+	before := InFlight()
+	blocker := make(chan struct{})
+	var changes int64
+	SetInFlightHook(func(int64) {
+		atomic.AddInt64(&changes, 1)
+	})
+	defer SetInFlightHook(nil)
+
+	promises := make([]*Promise, n)
+	for i := range promises {
+		promises[i] = New(func() {
+			<-blocker
+		})
+	}
+	requireEventually(t, func() bool {
+		return InFlight() >= before+n
+	}, time.Second, time.Millisecond)
+	require.True(t, atomic.LoadInt64(&changes) >= n)
+
+	close(blocker)
+	for _, p := range promises {
+		require.NoError(t, p.Wait())
+	}
+	requireEventually(t, func() bool {
+		return InFlight() <= before
+	}, time.Second, time.Millisecond)
+}
+
+func TestSetWatchdog(t *testing.T) {
+	type warning struct {
+		name   string
+		waited time.Duration
+	}
+	warnings := make(chan warning, 1)
+	SetWatchdog(10*time.Millisecond, func(name string, waited time.Duration) {
+		if name == "hung" {
+			warnings <- warning{name, waited}
+		}
+	})
+	defer SetWatchdog(0, nil)
+
+	p := New(func() {
+		time.Sleep(50 * time.Millisecond)
+	}).WithName("hung")
+	require.NoError(t, p.Wait())
+	require.Equal(t, warning{"hung", 10 * time.Millisecond}, <-warnings)
+
+	// Waits that can be interrupted by a context are watched too
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p = New(func() {
+		time.Sleep(50 * time.Millisecond)
+	}).WithName("hung")
+	require.NoError(t, p.WaitContext(ctx))
+	require.Equal(t, warning{"hung", 10 * time.Millisecond}, <-warnings)
+
+	// A wait that completes in time does not warn
+	require.NoError(t, New(func() {}).WithName("hung").Wait())
+	time.Sleep(20 * time.Millisecond)
+	require.Empty(t, warnings)
+}
+
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (err *wrappedError) Error() string {
+	return err.msg + ": " + err.err.Error()
+}
+
+func TestSetErrorWrapper(t *testing.T) {
+	SetErrorWrapper(func(err error, msg string) error {
+		return &wrappedError{msg, err}
+	})
+	defer SetErrorWrapper(nil)
+
+	failed := errors.New("failed")
+	p := New(func() error {
+		return failed
+	})
+	err := p.Wait()
+	require.Equal(t, &wrappedError{"error during promise execution", failed}, err)
+
+	err = All(p).Wait()
+	require.Equal(t, &wrappedError{"error during promise execution", &wrappedError{"error encountered in promise", failed}}, err)
+
+	SetErrorWrapper(nil)
+	require.EqualError(t, p.Wait(), "error during promise execution: failed")
+}
+
+func TestSetMaxChainDepth(t *testing.T) {
+	SetMaxChainDepth(3)
+	defer SetMaxChainDepth(0)
+
+	p := New(func() {})
+	for i := 0; i < 3; i++ {
+		p = p.Then(func() {})
+	}
+	requirePanicsWithError(t, "chain depth 4 exceeds the limit of 3 set with SetMaxChainDepth", func() {
+		p.Then(func() {})
+	})
+	requirePanicsWithError(t, "chain depth 4 exceeds the limit of 3 set with SetMaxChainDepth", func() {
+		p.Tap(func() {})
+	})
+	require.NoError(t, p.Wait())
+
+	// A combinator starts a new chain
+	require.NoError(t, All(p).Then(func() {}).Wait())
+
+	SetMaxChainDepth(0)
+	require.NoError(t, p.Then(func() {}).Wait())
+}
+
+func TestInvalidContinuationsEmitNoEvents(t *testing.T) {
+	SetMaxChainDepth(1)
+	defer SetMaxChainDepth(0)
+	p := New(func() int { return 1 })
+	deep := p.Then(func(x int) int { return x })
+	var result int
+	require.NoError(t, deep.Wait(&result))
+
+	var mu sync.Mutex
+	var created []uint64
+	SetObserver(func(event Event) {
+		if event.Kind == EventCreated {
+			mu.Lock()
+			created = append(created, event.ID)
+			mu.Unlock()
+		}
+	})
+	defer SetObserver(nil)
+
+	require.Panics(t, func() { p.Then(func(string) {}) })
+	require.Panics(t, func() { p.Tap(func(string) {}) })
+	require.Panics(t, func() { p.ThenErr(func(int) {}) })
+	require.Panics(t, func() { deep.Then(func(int) {}) })
+	require.Panics(t, func() { deep.Timeout(time.Second) })
+	SetObserver(nil)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Empty(t, created)
+}
+
+func TestSetObserver(t *testing.T) {
+	var mu sync.Mutex
+	var events []Event
+	SetObserver(func(event Event) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+	defer SetObserver(nil)
+
+	release := make(chan struct{})
+	first := New(func() int {
+		<-release
+		return 1
+	})
+	second := first.Then(func(x int) error {
+		return errors.New("failed")
+	}).WithName("second")
+	// Callbacks are called after the EventSettled of their promise
+	var settled sync.WaitGroup
+	settled.Add(2)
+	first.OnComplete(func(error) {
+		settled.Done()
+	})
+	second.OnComplete(func(error) {
+		settled.Done()
+	})
+	close(release)
+	settled.Wait()
+	SetObserver(nil)
+
+	mu.Lock()
+	defer mu.Unlock()
+	type step struct {
+		kind     EventKind
+		name     string
+		from, to State
+	}
+	steps := map[uint64][]step{}
+	for _, event := range events {
+		if event.ID != first.ID() && event.ID != second.ID() {
+			// Left over from other tests
+			continue
+		}
+		require.False(t, event.At.IsZero())
+		steps[event.ID] = append(steps[event.ID], step{event.Kind, event.Name, event.From, event.To})
+	}
+	require.Equal(t, []step{
+		{EventCreated, "", Pending, Pending},
+		{EventStarted, "", Pending, Pending},
+		{EventSettled, "", Pending, Resolved},
+	}, steps[first.ID()])
+	require.Equal(t, []step{
+		{EventCreated, "", Pending, Pending},
+		{EventStarted, "second", Pending, Pending},
+		{EventSettled, "second", Pending, Rejected},
+	}, steps[second.ID()])
+}
@@ -0,0 +1,29 @@
+package promise
+
+import (
+	"reflect"
+	"sync"
+)
+
+// NewLazy is like New, but f is not started until the promise is first
+// used: waited on, passed to OnComplete, chained with Then or a similar
+// method, or passed to a combinator such as All. f is started exactly once,
+// however many uses race to start it.
+func NewLazy(f interface{}, args ...interface{}) *Promise {
+	pr := prepare("NewLazy", reflect.ValueOf(f))
+	p, argValues := pr.bind(nil, args)
+	var once sync.Once
+	p.lazy = func() {
+		once.Do(func() {
+			p.start(pr.functionRv, nil, nil, 0, argValues)
+		})
+	}
+	return p
+}
+
+// demand starts the promise if it is lazy and has not been started yet.
+func (p *Promise) demand() {
+	if p.lazy != nil {
+		p.lazy()
+	}
+}
@@ -0,0 +1,73 @@
+package promise
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLazyStartsOnWait(t *testing.T) {
+	var calls int32
+	p := NewLazy(func(a int) int {
+		atomic.AddInt32(&calls, 1)
+		return a * 2
+	}, 2)
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	var result int
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, 4, result)
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestNewLazyStartsOnThen(t *testing.T) {
+	var calls int32
+	p := NewLazy(func() int {
+		atomic.AddInt32(&calls, 1)
+		return 1
+	})
+	next := p.Then(func(x int) int {
+		return x + 1
+	})
+	var result int
+	require.NoError(t, next.Wait(&result))
+	require.Equal(t, 2, result)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestNewLazyStartsOnCombinator(t *testing.T) {
+	p := NewLazy(func() int {
+		return 1
+	})
+	var results []int
+	require.NoError(t, All(p, New(func() int {
+		return 2
+	})).Wait(&results))
+	require.Equal(t, []int{1, 2}, results)
+}
+
+func TestNewLazyStartsOnce(t *testing.T) {
+	var calls int32
+	p := NewLazy(func() {
+		atomic.AddInt32(&calls, 1)
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, p.Wait())
+		}()
+		go func() {
+			defer wg.Done()
+			require.NoError(t, p.Then(func() {}).Wait())
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,141 @@
+package promise
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// ThenMap returns a promise that calls f concurrently with each element of
+// the slice this Promise resolves with, typically one returned by a Then
+// whose function produces a batch of items. This Promise must resolve with a
+// single []T, and f must accept a T and return a single U, optionally followed
+// by an error. The returned promise resolves with a []U holding the result
+// for each element in order.
+//
+// ThenMap fails fast: it fails as soon as any call of f fails, without
+// waiting for the others.
+func (p *Promise) ThenMap(f interface{}) *Promise {
+	if len(p.resultType) != 1 || p.resultType[0].Kind() != reflect.Slice {
+		panic(errors.Errorf("ThenMap requires a promise that returns a single slice, got %s", typeList(p.resultType)))
+	}
+	sliceType := p.resultType[0]
+
+	functionRv := reflect.ValueOf(f)
+	checkFunction("ThenMap", functionRv)
+	pr := prepare("ThenMap", functionRv)
+	if len(pr.inputs) != 1 || pr.inputs[0] != sliceType.Elem() {
+		panic(errors.Errorf("provided function must accept a single %s, got %s", sliceType.Elem(), typeList(pr.inputs)))
+	}
+	if len(pr.resultType) != 1 {
+		panic(errors.Errorf("provided function must return a single value, got %s", typeList(pr.resultType)))
+	}
+
+	mappedType := reflect.SliceOf(pr.resultType[0])
+	ctx := p.ctx
+	mapper := reflect.MakeFunc(reflect.FuncOf([]reflect.Type{sliceType}, []reflect.Type{mappedType}, false), func(args []reflect.Value) []reflect.Value {
+		slice := args[0]
+		mapped := reflect.MakeSlice(mappedType, slice.Len(), slice.Len())
+		if slice.Len() == 0 {
+			return []reflect.Value{mapped}
+		}
+		promises := make([]*Promise, slice.Len())
+		for i := range promises {
+			promises[i] = pr.promise(ctx)
+			promises[i].start(pr.functionRv, nil, nil, 0, []reflect.Value{slice.Index(i)})
+		}
+		results, err := All(promises...).outcome()
+		if err != nil {
+			panic(err)
+		}
+		for i, result := range results {
+			mapped.Index(i).Set(result)
+		}
+		return []reflect.Value{mapped}
+	})
+	return p.Then(mapper.Interface())
+}
+
+// ForEach returns a promise that calls f with each result of this Promise in
+// order, once it completes, then resolves with those same results, like Tap.
+// The results must all be of type T, such as those of All over promises
+// returning a T, and f must accept a single T and return nothing or an error.
+// If f returns an error, the remaining results are skipped and the returned
+// promise fails with it.
+func (p *Promise) ForEach(f interface{}) *Promise {
+	functionRv := reflect.ValueOf(f)
+	checkFunction("ForEach", functionRv)
+	reflectType := functionRv.Type()
+	if reflectType.NumIn() != 1 || reflectType.IsVariadic() {
+		panic(errors.Errorf("provided function must accept a single argument, got %s", reflectType))
+	}
+	outputs, returnsError := getResultType(reflectType)
+	if len(outputs) != 0 {
+		panic(errors.Errorf("provided function must return nothing or an error, got %s", reflectType))
+	}
+	elem := reflectType.In(0)
+	for i, resultType := range p.resultType {
+		if resultType != elem {
+			panic(errors.Errorf("for result %d: expected type %s got type %s", i, elem, resultType))
+		}
+	}
+
+	forEachType := reflect.FuncOf(p.resultType, append(append([]reflect.Type{}, p.resultType...), errorType), false)
+	forEach := reflect.MakeFunc(forEachType, func(results []reflect.Value) []reflect.Value {
+		for _, result := range results {
+			if out := functionRv.Call([]reflect.Value{result}); returnsError && !isNilError(out[0]) {
+				return append(zeroResults(p.resultType), out[0])
+			}
+		}
+		return append(append([]reflect.Value{}, results...), reflect.Zero(errorType))
+	})
+	return p.Then(forEach.Interface())
+}
+
+// Spread returns a promise that calls f with the elements of the slice this
+// Promise resolves with as separate arguments, once it completes, and
+// resolves like Then. This Promise must resolve with a single []T, and each
+// parameter of f must be a T; a variadic ...T parameter takes the remaining
+// elements. The returned promise fails if the length of the slice does not
+// match the number of parameters of f.
+func (p *Promise) Spread(f interface{}) *Promise {
+	if len(p.resultType) != 1 || p.resultType[0].Kind() != reflect.Slice {
+		panic(errors.Errorf("Spread requires a promise that returns a single slice, got %s", typeList(p.resultType)))
+	}
+	sliceType := p.resultType[0]
+
+	functionRv := reflect.ValueOf(f)
+	checkFunction("Spread", functionRv)
+	reflectType := functionRv.Type()
+	fixed := reflectType.NumIn()
+	if reflectType.IsVariadic() {
+		fixed--
+		if reflectType.In(fixed) != reflect.SliceOf(sliceType.Elem()) {
+			panic(errors.Errorf("for argument %d: expected type ...%s got type %s", fixed, sliceType.Elem(), reflectType.In(fixed)))
+		}
+	}
+	for i := 0; i < fixed; i++ {
+		if reflectType.In(i) != sliceType.Elem() {
+			panic(errors.Errorf("for argument %d: expected type %s got type %s", i, sliceType.Elem(), reflectType.In(i)))
+		}
+	}
+
+	outputs := make([]reflect.Type, reflectType.NumOut())
+	for i := range outputs {
+		outputs[i] = reflectType.Out(i)
+	}
+	spread := reflect.MakeFunc(reflect.FuncOf([]reflect.Type{sliceType}, outputs, false), func(args []reflect.Value) []reflect.Value {
+		slice := args[0]
+		if slice.Len() < fixed || (!reflectType.IsVariadic() && slice.Len() != fixed) {
+			panic(errors.Errorf("cannot spread %d elements over %s", slice.Len(), reflectType))
+		}
+		elems := make([]reflect.Value, slice.Len())
+		for i := range elems {
+			elems[i] = slice.Index(i)
+		}
+		return functionRv.Call(elems)
+	})
+	next, spreadRv := p.then(spread.Interface())
+	next.start(spreadRv, p, nil, 0, nil)
+	return next
+}
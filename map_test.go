@@ -0,0 +1,154 @@
+package promise
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThenMap(t *testing.T) {
+	// Every call blocks until all five have started, so the test only
+	// completes if they run concurrently
+	var started sync.WaitGroup
+	started.Add(5)
+	p := New(func() ([]string, error) {
+		return []string{"a", "b", "c", "d", "e"}, nil
+	}).ThenMap(func(s string) string {
+		started.Done()
+		started.Wait()
+		return strings.ToUpper(s)
+	})
+	var results []string
+	require.NoError(t, p.Wait(&results))
+	require.Equal(t, []string{"A", "B", "C", "D", "E"}, results)
+}
+
+func TestThenMapEmpty(t *testing.T) {
+	p := New(func() []int {
+		return nil
+	}).ThenMap(func(x int) string {
+		return "unreachable"
+	})
+	var results []string
+	require.NoError(t, p.Wait(&results))
+	require.Empty(t, results)
+}
+
+func TestThenMapFailsFast(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	p := New(func() []int {
+		return []int{1, 2, 3}
+	}).ThenMap(func(x int) (int, error) {
+		if x == 2 {
+			return 0, errors.New("failed")
+		}
+		<-blocker
+		return x, nil
+	})
+	err := p.Wait(new([]int))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed")
+}
+
+func TestThenMapValidates(t *testing.T) {
+	ints := New(func() []int {
+		return nil
+	})
+	requirePanicsWithError(t, "ThenMap requires a promise that returns a single slice, got (int)", func() {
+		New(func() int { return 0 }).ThenMap(func(int) int { return 0 })
+	})
+	requirePanicsWithError(t, "provided function must accept a single int, got (string)", func() {
+		ints.ThenMap(func(string) int { return 0 })
+	})
+	requirePanicsWithError(t, "provided function must return a single value, got ()", func() {
+		ints.ThenMap(func(int) {})
+	})
+}
+
+func TestForEach(t *testing.T) {
+	var written []int
+	p := All(New(func() int {
+		time.Sleep(10 * time.Millisecond)
+		return 1
+	}), New(func() int {
+		return 2
+	}), New(func() int {
+		return 3
+	})).ForEach(func(x int) {
+		written = append(written, x)
+	})
+	var results []int
+	require.NoError(t, p.Wait(&results))
+	require.Equal(t, []int{1, 2, 3}, written)
+	require.Equal(t, []int{1, 2, 3}, results)
+
+	written = nil
+	failing := All(New(func() int {
+		return 1
+	}), New(func() int {
+		return 2
+	})).ForEach(func(x int) error {
+		if x == 1 {
+			return errors.New("sink failed")
+		}
+		written = append(written, x)
+		return nil
+	})
+	require.EqualError(t, failing.Wait(&results), "error during promise execution: sink failed")
+	require.Empty(t, written)
+}
+
+func TestForEachValidates(t *testing.T) {
+	p := New(func() (int, string) {
+		return 1, "one"
+	})
+	requirePanicsWithError(t, "for result 1: expected type int got type string", func() {
+		p.ForEach(func(int) {})
+	})
+	requirePanicsWithError(t, "provided function must return nothing or an error, got func(int) int", func() {
+		p.ForEach(func(x int) int { return x })
+	})
+	requirePanicsWithError(t, "provided function must accept a single argument, got func(int, string)", func() {
+		p.ForEach(func(int, string) {})
+	})
+}
+
+func TestSpread(t *testing.T) {
+	coordinates := New(func() []int {
+		return []int{1, 2, 3}
+	})
+	var sum int
+	require.NoError(t, coordinates.Spread(func(x, y, z int) int {
+		return x + y + z
+	}).Wait(&sum))
+	require.Equal(t, 6, sum)
+
+	var rest []int
+	require.NoError(t, coordinates.Spread(func(x int, rest ...int) []int {
+		return rest
+	}).Wait(&rest))
+	require.Equal(t, []int{2, 3}, rest)
+
+	err := coordinates.Spread(func(x, y int) {}).Wait()
+	require.EqualError(t, err, "error during promise execution: cannot spread 3 elements over func(int, int)")
+	err = coordinates.Spread(func(a, b, c, d int, rest ...int) {}).Wait()
+	require.EqualError(t, err, "error during promise execution: cannot spread 3 elements over func(int, int, int, int, ...int)")
+}
+
+func TestSpreadValidates(t *testing.T) {
+	requirePanicsWithError(t, "Spread requires a promise that returns a single slice, got (int)", func() {
+		New(func() int { return 1 }).Spread(func(int) {})
+	})
+	p := New(func() []int { return nil })
+	requirePanicsWithError(t, "for argument 1: expected type int got type string", func() {
+		p.Spread(func(int, string) {})
+	})
+	requirePanicsWithError(t, "for argument 0: expected type ...int got type []string", func() {
+		p.Spread(func(...string) {})
+	})
+}
@@ -0,0 +1,89 @@
+package promise
+
+import (
+	"time"
+)
+
+// Pipeline builds a chain of promises step by step, so that a long chain
+// reads top to bottom. Each step is validated immediately like the
+// corresponding method of Promise, but an invalid step is recorded instead
+// of panicking, and the remaining steps are skipped.
+type Pipeline struct {
+	p   *Promise
+	err error
+}
+
+// Pipe starts a pipeline from initial.
+func Pipe(initial *Promise) *Pipeline {
+	return &Pipeline{p: initial}
+}
+
+// step applies next to the current promise unless an earlier step failed.
+func (pl *Pipeline) step(next func(p *Promise) *Promise) *Pipeline {
+	if pl.err != nil {
+		return pl
+	}
+	var p *Promise
+	pl.err = validate(func() {
+		p = next(pl.p)
+	})
+	if pl.err == nil {
+		pl.p = p
+	}
+	return pl
+}
+
+// Then adds a step that calls f with the results of the previous step. See
+// Promise.Then.
+func (pl *Pipeline) Then(f interface{}) *Pipeline {
+	return pl.step(func(p *Promise) *Promise {
+		return p.Then(f)
+	})
+}
+
+// ThenErr adds a step that calls f with the results and error of the previous
+// step. See Promise.ThenErr.
+func (pl *Pipeline) ThenErr(f interface{}) *Pipeline {
+	return pl.step(func(p *Promise) *Promise {
+		return p.ThenErr(f)
+	})
+}
+
+// Tap adds a step that calls f with the results of the previous step and
+// passes them on. See Promise.Tap.
+func (pl *Pipeline) Tap(f interface{}) *Pipeline {
+	return pl.step(func(p *Promise) *Promise {
+		return p.Tap(f)
+	})
+}
+
+// Catch adds a step that recovers from a failure of the previous steps. See
+// Promise.Catch.
+func (pl *Pipeline) Catch(f interface{}) *Pipeline {
+	return pl.step(func(p *Promise) *Promise {
+		return p.Catch(f)
+	})
+}
+
+// Timeout adds a step that fails with ErrTimeout if the previous step does
+// not complete within d. See Promise.Timeout.
+func (pl *Pipeline) Timeout(d time.Duration) *Pipeline {
+	return pl.step(func(p *Promise) *Promise {
+		return p.Timeout(d)
+	})
+}
+
+// Err returns the *ValidationError of the first invalid step, if any.
+func (pl *Pipeline) Err() error {
+	return pl.err
+}
+
+// Build returns the promise of the last step. It panics with the error of
+// the first invalid step, like the corresponding method of Promise would
+// have; check Err first to handle it instead.
+func (pl *Pipeline) Build() *Promise {
+	if pl.err != nil {
+		panic(pl.err)
+	}
+	return pl.p
+}
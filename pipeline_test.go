@@ -0,0 +1,39 @@
+package promise
+
+import (
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineInvalidStep(t *testing.T) {
+	called := false
+	pl := Pipe(New(func() int {
+		return 1
+	})).
+		Then(func(s string) {}).
+		Then(func() {
+			called = true
+		})
+	require.IsType(t, &ValidationError{}, pl.Err())
+	require.EqualError(t, pl.Err(), "for argument 0: expected type int got type string")
+	require.Panics(t, func() {
+		pl.Build()
+	})
+	require.False(t, called)
+}
+
+func TestPipelineTimeout(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	p := Pipe(New(func() int {
+		<-blocker
+		return 1
+	})).Timeout(10 * time.Millisecond).Build()
+	var result int
+	err := p.Wait(&result)
+	require.Error(t, err)
+	require.Equal(t, ErrTimeout, pkgerrors.Cause(err))
+}
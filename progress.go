@@ -0,0 +1,97 @@
+package promise
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// NewWithProgress is like New, but f must accept a report function as its
+// first parameter, followed by args. f calls report with its progress, such
+// as a percentage, which is delivered to the callbacks registered with
+// OnProgress. Progress is delivered monotonically: a value lower than one
+// already reported is dropped.
+func NewWithProgress(f interface{}, args ...interface{}) *Promise {
+	pr := prepare("NewWithProgress", reflect.ValueOf(f))
+	if len(pr.inputs) == 0 || pr.inputs[0] != reportType {
+		panic(errors.Errorf("expected the first parameter to be %s, got %s", reportType, pr.functionRv.Type()))
+	}
+	rest := pr
+	rest.inputs = pr.inputs[1:]
+	p, argValues := rest.bind(nil, args)
+	p.progress = &progress{}
+	report := p.progress.report
+	p.start(pr.functionRv, nil, nil, 0, append([]reflect.Value{reflect.ValueOf(report)}, argValues...))
+	return p
+}
+
+var reportType = reflect.TypeOf(func(float64) {})
+
+// OnProgress registers f to be called with each progress update reported by
+// the function of a promise created with NewWithProgress. Updates are
+// delivered from the goroutine of the function. If progress was already
+// reported, f is first called synchronously with the latest value. f is
+// never called for other promises.
+func (p *Promise) OnProgress(f func(float64)) {
+	if p.progress != nil {
+		p.progress.subscribe(f)
+	}
+}
+
+// progress fans out the progress reported by a function to its subscribers.
+type progress struct {
+	mu          sync.Mutex
+	reported    bool
+	last        float64
+	subscribers []*progressSubscriber
+}
+
+// progressSubscriber delivers progress to a single callback, serializing the
+// calls and dropping stale values, so that the callback sees monotonic
+// progress even while it is subscribing concurrently with a report.
+type progressSubscriber struct {
+	mu        sync.Mutex
+	delivered bool
+	last      float64
+	f         func(float64)
+}
+
+func (pg *progress) report(value float64) {
+	pg.mu.Lock()
+	if pg.reported && value < pg.last {
+		pg.mu.Unlock()
+		return
+	}
+	pg.reported = true
+	pg.last = value
+	subscribers := pg.subscribers
+	pg.mu.Unlock()
+	for _, s := range subscribers {
+		s.deliver(value)
+	}
+}
+
+func (pg *progress) subscribe(f func(float64)) {
+	s := &progressSubscriber{f: f}
+	pg.mu.Lock()
+	// Subscribers are never removed, so appending does not disturb the
+	// slices being delivered to
+	pg.subscribers = append(pg.subscribers, s)
+	reported, last := pg.reported, pg.last
+	pg.mu.Unlock()
+	if reported {
+		s.deliver(last)
+	}
+}
+
+func (s *progressSubscriber) deliver(value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.delivered && value <= s.last {
+		return
+	}
+	s.delivered = true
+	s.last = value
+	s.f(value)
+}
@@ -0,0 +1,86 @@
+package promise
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithProgress(t *testing.T) {
+	started := make(chan struct{})
+	resume := make(chan struct{})
+	p := NewWithProgress(func(report func(float64), steps int) int {
+		report(0)
+		close(started)
+		<-resume
+		for i := 1; i <= steps; i++ {
+			report(float64(i) * 100 / float64(steps))
+			// Going backwards is dropped
+			report(0)
+		}
+		return steps
+	}, 4)
+
+	var mu sync.Mutex
+	var early, late []float64
+	p.OnProgress(func(value float64) {
+		mu.Lock()
+		early = append(early, value)
+		mu.Unlock()
+	})
+	<-started
+	p.OnProgress(func(value float64) {
+		mu.Lock()
+		late = append(late, value)
+		mu.Unlock()
+	})
+	close(resume)
+
+	var steps int
+	require.NoError(t, p.Wait(&steps))
+	require.Equal(t, 4, steps)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []float64{25, 50, 75, 100}, early[len(early)-4:])
+	require.Equal(t, []float64{0, 25, 50, 75, 100}, late)
+
+	// Subscribing after completion delivers the latest progress
+	var last []float64
+	p.OnProgress(func(value float64) {
+		last = append(last, value)
+	})
+	require.Equal(t, []float64{100}, last)
+}
+
+func TestProgressIsMonotonicUnderConcurrentSubscribers(t *testing.T) {
+	p := NewWithProgress(func(report func(float64)) {
+		for i := 0; i <= 1000; i++ {
+			report(float64(i))
+		}
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := -1.0
+			p.OnProgress(func(value float64) {
+				require.Greater(t, value, last)
+				last = value
+			})
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, p.Wait())
+}
+
+func TestNewWithProgressValidates(t *testing.T) {
+	requirePanicsWithError(t, "expected the first parameter to be func(float64), got func(int) int", func() {
+		NewWithProgress(func(x int) int { return x }, 1)
+	})
+	// Promises without progress never call OnProgress callbacks
+	New(func() {}).OnProgress(func(float64) {
+		t.Fatal("unexpected progress")
+	})
+}
@@ -1,10 +1,16 @@
 package promise
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -14,9 +20,12 @@ type promiseType int
 const (
 	simpleCall promiseType = iota
 	thenCall
+	thenErrCall
+	tapCall
 	allCall
 	raceCall
 	anyCall
+	someCall
 )
 
 // A Promise represents an asynchronously executing unit of work
@@ -33,7 +42,68 @@ type Promise struct {
 	cond         sync.Cond
 	counter      int64
 	errCounter   int64
-	noCopy
+	// partial collects the results of Some in completion order
+	partial []reflect.Value
+	// weight is the share of the budget of a weighted pool the function of
+	// the promise takes, see WithWeight
+	weight int64
+	// weighed is set once the weight is read to run the function
+	weighed bool
+	// executor runs the work of the promise, it is recorded by start
+	executor Executor
+	// priors are the promises passed to a combinator, see CancelAndCollect
+	priors []*Promise
+	// callbacks are called once the promise settles, see OnComplete
+	callbacks []func(err error)
+	// done is closed once the promise settles, it is made on demand by
+	// doneChan
+	done chan struct{}
+	// name labels the promise for debugging, see WithName
+	name string
+	// cancelled is true if the promise was settled by Cancel
+	cancelled bool
+	// ctx is the context of NewWithContext, inherited by continuations
+	ctx context.Context
+	// depth is the number of continuations between the promise and the
+	// start of its chain, see SetMaxChainDepth
+	depth int
+	// id uniquely identifies the promise, see ID
+	id uint64
+	// lazy starts a promise created by NewLazy, it is nil otherwise
+	lazy func()
+	// progress is reported by the function of a promise created by
+	// NewWithProgress, it is nil otherwise
+	progress *progress
+	// handled is non-zero once the outcome of the promise is observed, see
+	// SetUnhandledHandler
+	handled int32
+	// startedAt and finishedAt are the times the function of the promise
+	// was invoked and returned, they are zero for promises without a
+	// function such as combinators
+	startedAt  time.Time
+	finishedAt time.Time
+	// cond already makes go vet's copylocks check report copies of a
+	// Promise, noCopy states the intent explicitly. It is a named field so
+	// that its Lock and Unlock methods are not promoted to Promise.
+	noCopy noCopy
+}
+
+// lastID is the ID of the most recently created promise
+var lastID uint64
+
+func newPromise(t promiseType) *Promise {
+	p := &Promise{
+		cond: sync.Cond{L: &sync.Mutex{}},
+		t:    t,
+		id:   atomic.AddUint64(&lastID, 1),
+	}
+	p.emit(EventCreated, "", Pending, Pending)
+	return p
+}
+
+// ID returns a number that uniquely identifies the promise within the process.
+func (p *Promise) ID() uint64 {
+	return p.id
 }
 
 // Used to trigger lint rules if a promise is copied
@@ -42,7 +112,7 @@ type noCopy struct{}
 func (*noCopy) Lock()   {}
 func (*noCopy) Unlock() {}
 
-func (p *Promise) raceCall(priors []*Promise, index int) (results []reflect.Value) {
+func (p *Promise) raceCall(priors []*Promise, index int) (results []reflect.Value, ok bool) {
 	prior := priors[index]
 	prior.cond.L.Lock()
 	for !prior.complete {
@@ -50,16 +120,16 @@ func (p *Promise) raceCall(priors []*Promise, index int) (results []reflect.Valu
 	}
 	prior.cond.L.Unlock()
 	if prior.err != nil {
-		panic(errors.Wrap(prior.err, "error encountered in promise"))
+		panic(wrapError(prior.err, prior.label("error encountered in promise")))
 	}
 	remaining := atomic.AddInt64(&p.counter, -1)
 	if remaining == 0 {
-		return prior.results[:]
+		return prior.results[:], true
 	}
-	return nil
+	return nil, false
 }
 
-func (p *Promise) allCall(priors []*Promise, index int) (results []reflect.Value) {
+func (p *Promise) allCall(priors []*Promise, index int) (results []reflect.Value, ok bool) {
 	prior := priors[index]
 	prior.cond.L.Lock()
 	for !prior.complete {
@@ -67,7 +137,7 @@ func (p *Promise) allCall(priors []*Promise, index int) (results []reflect.Value
 	}
 	prior.cond.L.Unlock()
 	if prior.err != nil {
-		panic(errors.Wrap(prior.err, "error encountered in promise"))
+		panic(wrapError(prior.err, prior.label("error encountered in promise")))
 	}
 	remaining := atomic.AddInt64(&p.counter, -1)
 	if remaining == 0 {
@@ -79,9 +149,9 @@ func (p *Promise) allCall(priors []*Promise, index int) (results []reflect.Value
 		for _, completedPromise := range priors {
 			results = append(results, completedPromise.results...)
 		}
-		return results
+		return results, true
 	}
-	return nil
+	return nil, false
 }
 
 // AnyErr returns when all promises passed to Any fail
@@ -96,7 +166,86 @@ func (err *AnyErr) Error() string {
 	return fmt.Sprintf("all %d promises failed. last err=%v", len(err.Errs), err.LastErr)
 }
 
-func (p *Promise) anyCall(priors []*Promise, index int) (results []reflect.Value) {
+// Unwrap returns the errors of all passed promises. errors.Is and errors.As
+// only follow it from Go 1.20, see Is and As.
+func (err *AnyErr) Unwrap() []error {
+	return err.Errs
+}
+
+// Is reports whether any of the errors of the passed promises matches target,
+// so that errors.Is matches them on any Go version.
+func (err *AnyErr) Is(target error) bool {
+	for _, e := range err.Errs {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors of the passed promises that matches
+// target, so that errors.As matches them on any Go version.
+func (err *AnyErr) As(target interface{}) bool {
+	for _, e := range err.Errs {
+		if errors.As(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// PanicError is the error of a promise whose function panicked with a value
+// that is not an error. Panics with an error value fail the promise with that
+// error directly.
+type PanicError struct {
+	value interface{}
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("%+v", err.value)
+}
+
+// Value returns the value passed to panic.
+func (err *PanicError) Value() interface{} {
+	return err.value
+}
+
+// RuntimeError is the error of a promise whose function panicked with a
+// runtime error, such as a nil pointer dereference or an index out of range,
+// as opposed to an intentional panic. Use errors.As to tell them apart.
+type RuntimeError struct {
+	err   runtime.Error
+	stack []byte
+}
+
+func (err *RuntimeError) Error() string {
+	return err.err.Error()
+}
+
+// Unwrap returns the runtime error.
+func (err *RuntimeError) Unwrap() error {
+	return err.err
+}
+
+// Stack returns the stack trace of the goroutine that panicked.
+func (err *RuntimeError) Stack() []byte {
+	return err.stack
+}
+
+// recovered returns the error a promise fails with when its function panics
+// with r. It must be called from the deferred function that recovered r, so
+// that the stack of a runtime error is captured.
+func recovered(r interface{}) error {
+	switch r := r.(type) {
+	case runtime.Error:
+		return &RuntimeError{err: r, stack: debug.Stack()}
+	case error:
+		return r
+	}
+	return &PanicError{value: r}
+}
+
+func (p *Promise) anyCall(priors []*Promise, index int) (results []reflect.Value, ok bool) {
 	prior := priors[index]
 	prior.cond.L.Lock()
 	for !prior.complete {
@@ -104,32 +253,81 @@ func (p *Promise) anyCall(priors []*Promise, index int) (results []reflect.Value
 	}
 	prior.cond.L.Unlock()
 	if prior.err != nil {
-		remaining := atomic.AddInt64(&p.errCounter, -1)
+		// Record the error before counting it, under the lock, so that the
+		// last waiter to fail reads every error recorded by the others
+		p.cond.L.Lock()
 		p.anyErrs[index] = prior.err
+		p.cond.L.Unlock()
+		remaining := atomic.AddInt64(&p.errCounter, -1)
 		if remaining != 0 {
-			return nil
+			return nil, false
+		}
+		p.cond.L.Lock()
+		complete := p.complete
+		errs := append([]error(nil), p.anyErrs...)
+		p.cond.L.Unlock()
+		if complete {
+			// A promise already succeeded, the late failures are moot
+			return nil, false
 		}
-		panic(AnyErr{Errs: p.anyErrs[:], LastErr: prior.err})
+		panic(&AnyErr{Errs: errs, LastErr: prior.err})
 	}
 	remaining := atomic.AddInt64(&p.counter, -1)
 	if remaining == 0 {
-		return prior.results[:]
+		return prior.results[:], true
 	}
-	return nil
+	return nil, false
+}
+
+func (p *Promise) someCall(priors []*Promise, index int) (results []reflect.Value, ok bool) {
+	prior := priors[index]
+	prior.cond.L.Lock()
+	for !prior.complete {
+		prior.cond.Wait()
+	}
+	prior.cond.L.Unlock()
+	if prior.err != nil {
+		remaining := atomic.AddInt64(&p.errCounter, -1)
+		if remaining != 0 {
+			return nil, false
+		}
+		panic(wrapError(prior.err, prior.label("too many promises failed")))
+	}
+	// Collect under the lock so results are kept in completion order
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	if p.counter == 0 {
+		return nil, false
+	}
+	p.partial = append(p.partial, prior.results...)
+	p.counter--
+	return p.partial, p.counter == 0
 }
 
 func empty() {}
 
+// checkPromises panics with a clear error if any of the promises is nil,
+// rather than failing deep inside a waiter.
+func checkPromises(promises []*Promise) {
+	for i, p := range promises {
+		if p == nil {
+			panic(errors.Errorf("promise at index %d is nil", i))
+		}
+	}
+}
+
 // All returns a promise that resolves if all of the passed promises
 // succeed or fails if any of the passed promises panics.
+// It resolves with the results of the passed promises concatenated in order,
+// so a continuation chained with Then accepts all of them as parameters, or
+// a single []T or ...T parameter if they all have the type T.
 func All(promises ...*Promise) *Promise {
+	checkPromises(promises)
 	if len(promises) == 0 {
 		return New(empty)
 	}
-	p := &Promise{
-		cond: sync.Cond{L: &sync.Mutex{}},
-		t:    allCall,
-	}
+	p := newPromise(allCall)
+	p.priors = promises
 
 	// Extract the type
 	p.resultType = []reflect.Type{}
@@ -140,43 +338,244 @@ func All(promises ...*Promise) *Promise {
 	p.counter = int64(len(promises))
 
 	for i := range promises {
-		go p.run(reflect.Value{}, nil, promises, i, nil)
+		p.start(reflect.Value{}, nil, promises, i, nil)
 	}
 	return p
 }
 
-const anyErrorFormat = "promise %d has an unexpected return type, expected all promises passed to Any to return the same type"
+// IndexedResult holds the results of one of the promises passed to
+// AllIndexed.
+type IndexedResult struct {
+	// Index is the position of the promise among those passed
+	Index int
+	// Values contains the results of the promise
+	Values []interface{}
+}
 
-// Race returns a promise that resolves if any of the passed promises
-// succeed or fails if any of the passed promises panics.
-// All of the supplied promises must be of the same type.
-func Race(promises ...*Promise) *Promise {
-	if len(promises) == 0 {
-		return New(empty)
+// AllIndexed is like All, but resolves with a single []IndexedResult holding
+// the results of each promise with its index, in the order in which the
+// promises complete. Unlike All, the promises may return any mix of types.
+//
+// AllIndexed fails fast: it fails as soon as any promise fails, with an error
+// naming the index of the failed promise.
+func AllIndexed(promises ...*Promise) *Promise {
+	checkPromises(promises)
+	return New(func() ([]IndexedResult, error) {
+		done := make(chan int, len(promises))
+		for i, p := range promises {
+			i := i
+			p.OnComplete(func(error) {
+				done <- i
+			})
+		}
+		indexed := make([]IndexedResult, 0, len(promises))
+		for range promises {
+			i := <-done
+			results, err := promises[i].outcome()
+			if err != nil {
+				return nil, wrapError(err, promises[i].label(fmt.Sprintf("error in promise %d", i)))
+			}
+			indexed = append(indexed, IndexedResult{Index: i, Values: interfaces(results)})
+		}
+		return indexed, nil
+	})
+}
+
+// AllTolerant is like All, but tolerates up to maxFailures failed promises.
+// Once all of the promises settle, it resolves with a single []Settled holding
+// the outcome of each promise, successful or not, in the order the promises
+// were passed. It fails as soon as more than maxFailures promises fail, with
+// the error of the one that exceeded the limit, without waiting for the
+// others.
+func AllTolerant(maxFailures int, promises ...*Promise) *Promise {
+	checkPromises(promises)
+	if maxFailures < 0 {
+		panic(errors.Errorf("AllTolerant requires a non-negative number of failures, got %d", maxFailures))
 	}
+	return New(func() ([]Settled, error) {
+		done := make(chan int, len(promises))
+		for i, p := range promises {
+			i := i
+			p.OnComplete(func(error) {
+				done <- i
+			})
+		}
+		settled := make([]Settled, len(promises))
+		failures := 0
+		for range promises {
+			i := <-done
+			results, err := promises[i].outcome()
+			settled[i] = Settled{Index: i, Err: promises[i].waitError()}
+			if err == nil {
+				settled[i].Values = interfaces(results)
+				continue
+			}
+			failures++
+			if failures > maxFailures {
+				return nil, wrapError(err, promises[i].label(fmt.Sprintf("too many promises failed, %d failures exceed the limit of %d", failures, maxFailures)))
+			}
+		}
+		return settled, nil
+	})
+}
 
-	if len(promises) == 1 {
-		return promises[0]
+// AllStruct is like All, but assigns the concatenated results of the promises
+// to the exported fields of the struct dst points to, in declaration order.
+// The number and types of the fields must match the results. The returned
+// promise resolves with no values once dst has been assigned; dst must not be
+// read before then.
+func AllStruct(dst interface{}, promises ...*Promise) *Promise {
+	all := All(promises...)
+	bind := structBinder(all.resultType, dst)
+	assign := reflect.MakeFunc(reflect.FuncOf(all.resultType, nil, false), func(results []reflect.Value) []reflect.Value {
+		bind(results)
+		return nil
+	})
+	return all.Then(assign.Interface())
+}
+
+// Merge is like AllStruct, but assigns the single result of each promise in
+// named to the field of the struct dst points to whose name is its key, so
+// that promises of different types are gathered by name rather than by
+// position. Fields without a promise are left alone. The returned promise
+// resolves with no values once dst has been assigned, and fails fast like
+// All.
+func Merge(dst interface{}, named map[string]*Promise) *Promise {
+	dstRv := reflect.ValueOf(dst)
+	if !dstRv.IsValid() || dstRv.Kind() != reflect.Ptr || dstRv.Elem().Kind() != reflect.Struct {
+		panic(errors.Errorf("expected pointer to struct, got %T", dst))
+	}
+	if dstRv.IsNil() {
+		panic(errors.New("destination struct pointer is nil"))
 	}
+	structRv := dstRv.Elem()
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	promises := make([]*Promise, len(names))
+	for i, name := range names {
+		p := named[name]
+		if p == nil {
+			panic(errors.Errorf("promise for field %s is nil", name))
+		}
+		field, ok := structRv.Type().FieldByName(name)
+		if !ok || field.PkgPath != "" {
+			panic(errors.Errorf("%s has no exported field %s", structRv.Type(), name))
+		}
+		if len(p.resultType) != 1 || !p.resultType[0].AssignableTo(field.Type) {
+			panic(errors.Errorf("for field %s: expected a promise returning %s, got %s", name, field.Type, typeList(p.resultType)))
+		}
+		promises[i] = p
+	}
+	all := All(promises...)
+	assign := reflect.MakeFunc(reflect.FuncOf(all.resultType, nil, false), func(results []reflect.Value) []reflect.Value {
+		for i, name := range names {
+			structRv.FieldByName(name).Set(results[i])
+		}
+		return nil
+	})
+	return all.Then(assign.Interface())
+}
+
+const sameTypeErrorFormat = "promise %d has an unexpected return type, expected all promises passed to %s to return the same type"
 
-	// Check that all the promises have the same return type
+// sameResultType panics unless all of the promises have compatible result
+// types, and returns them. Result types are compatible if, at each position,
+// one of the promises has a type that the types of all the others are
+// assignable to, such as an interface they all implement. caller names the
+// function the promises were passed to in the error.
+func sameResultType(caller string, promises []*Promise) []reflect.Type {
 	firstResultType := promises[0].resultType
 	for promiseIdx, promise := range promises[1:] {
-		newResultType := promise.resultType
-		if len(firstResultType) != len(newResultType) {
-			panic(errors.Errorf(anyErrorFormat, promiseIdx))
+		if len(firstResultType) != len(promise.resultType) {
+			panic(errors.Errorf(sameTypeErrorFormat, promiseIdx+1, caller))
+		}
+	}
+	resultType := make([]reflect.Type, len(firstResultType))
+	for index := range firstResultType {
+		resultType[index] = commonType(promises, index)
+		if resultType[index] != nil {
+			continue
 		}
-		for index := range firstResultType {
-			if firstResultType[index] != newResultType[index] {
-				panic(errors.Errorf(anyErrorFormat, promiseIdx))
+		for promiseIdx, promise := range promises[1:] {
+			if promise.resultType[index] != firstResultType[index] {
+				panic(errors.Errorf(sameTypeErrorFormat, promiseIdx+1, caller))
 			}
 		}
 	}
+	return resultType
+}
 
-	p := &Promise{
-		cond: sync.Cond{L: &sync.Mutex{}},
-		t:    raceCall,
+// commonType returns the result type at index of one of the promises that the
+// result types of all of them are assignable to, or nil if there is none.
+func commonType(promises []*Promise, index int) reflect.Type {
+	for _, candidate := range promises {
+		common := candidate.resultType[index]
+		assignable := true
+		for _, promise := range promises {
+			if !promise.resultType[index].AssignableTo(common) {
+				assignable = false
+				break
+			}
+		}
+		if assignable {
+			return common
+		}
+	}
+	return nil
+}
+
+// resultTypeAs panics unless all of the promises return a single value
+// assignable to as, and returns as as their result type. caller names the
+// function the promises were passed to in the error.
+func resultTypeAs(caller string, as reflect.Type, promises []*Promise) []reflect.Type {
+	if as == nil {
+		panic(errors.Errorf("%s requires a result type", caller))
+	}
+	if len(promises) == 0 {
+		panic(errors.Errorf("%s requires at least one promise", caller))
+	}
+	for promiseIdx, promise := range promises {
+		if len(promise.resultType) != 1 || !promise.resultType[0].AssignableTo(as) {
+			panic(errors.Errorf("promise %d returns %s, expected all promises passed to %s to return a single value assignable to %s", promiseIdx, typeList(promise.resultType), caller, as))
+		}
+	}
+	return []reflect.Type{as}
+}
+
+// Race returns a promise that resolves if any of the passed promises
+// succeed or fails if any of the passed promises panics.
+// All of the supplied promises must be of the same type, except that where
+// one of them returns an interface, the others may return any types
+// implementing it; the returned promise then returns the interface. Use
+// RaceAs to race promises returning different types that none of them
+// returns, such as two concrete types implementing the same interface.
+//
+// The returned promise is always a new promise, even for a single promise, so
+// that it can be named, cancelled or chained independently of its input.
+func Race(promises ...*Promise) *Promise {
+	checkPromises(promises)
+	if len(promises) == 0 {
+		return New(empty)
 	}
+	return race(sameResultType("Race", promises), promises)
+}
+
+// RaceAs is like Race, but the promises may return any single value
+// assignable to as, typically an interface, and the returned promise returns
+// an as. For instance, RaceAs(reflect.TypeOf((*io.Reader)(nil)).Elem(), p, q)
+// races p returning a *bytes.Buffer and q returning a *strings.Reader, and
+// can be waited into an io.Reader. At least one promise must be passed.
+func RaceAs(as reflect.Type, promises ...*Promise) *Promise {
+	checkPromises(promises)
+	return race(resultTypeAs("RaceAs", as, promises), promises)
+}
+
+func race(firstResultType []reflect.Type, promises []*Promise) *Promise {
+	p := newPromise(raceCall)
+	p.priors = promises
 
 	// Extract the type
 	p.resultType = firstResultType[:]
@@ -184,51 +583,111 @@ func Race(promises ...*Promise) *Promise {
 	p.counter = int64(1)
 
 	for i := range promises {
-		go p.run(reflect.Value{}, nil, promises, i, nil)
+		p.start(reflect.Value{}, nil, promises, i, nil)
 	}
 	return p
 }
 
 // Any returns a promise that resolves if any of the passed promises
 // succeed or fails if all of the passed promises panics.
-// All of the supplied promises must be of the same type.
+// All of the supplied promises must be of the same type, or implement an
+// interface returned by one of them, as for Race. Like Race, it always
+// returns a new promise; if a single passed promise fails, the returned
+// promise fails with an *AnyErr holding its error.
 func Any(promises ...*Promise) *Promise {
+	checkPromises(promises)
 	if len(promises) == 0 {
 		return New(empty)
 	}
+	return anyOf(sameResultType("Any", promises), promises)
+}
+
+// AnyAs is like Any, but the promises may return any single value assignable
+// to as, and the returned promise returns an as, see RaceAs.
+func AnyAs(as reflect.Type, promises ...*Promise) *Promise {
+	checkPromises(promises)
+	return anyOf(resultTypeAs("AnyAs", as, promises), promises)
+}
+
+func anyOf(firstResultType []reflect.Type, promises []*Promise) *Promise {
+	p := newPromise(anyCall)
+	p.priors = promises
+	p.anyErrs = make([]error, len(promises))
+
+	// Extract the type
+	p.resultType = firstResultType[:]
 
-	if len(promises) == 1 {
-		return promises[0]
+	p.counter = int64(1)
+	p.errCounter = int64(len(promises))
+
+	for i := range promises {
+		p.start(reflect.Value{}, nil, promises, i, nil)
 	}
+	return p
+}
 
-	// Check that all the promises have the same return type
-	firstResultType := promises[0].resultType
-	for promiseIdx, promise := range promises[1:] {
-		newResultType := promise.resultType
-		if len(firstResultType) != len(newResultType) {
-			panic(errors.Errorf(anyErrorFormat, promiseIdx))
-		}
-		for index := range firstResultType {
-			if firstResultType[index] != newResultType[index] {
-				panic(errors.Errorf(anyErrorFormat, promiseIdx))
+// AnyIndexed is like Any, but the returned promise resolves with the index of
+// the winning promise as an extra leading int result, followed by its results.
+// At least one promise must be passed.
+func AnyIndexed(promises ...*Promise) *Promise {
+	checkPromises(promises)
+	if len(promises) == 0 {
+		panic(errors.New("AnyIndexed requires at least one promise"))
+	}
+	resultType := sameResultType("AnyIndexed", promises)
+	outputs := append([]reflect.Type{reflect.TypeOf(0)}, resultType...)
+
+	indexed := make([]*Promise, len(promises))
+	for i, prior := range promises {
+		index := reflect.ValueOf(i)
+		// Each prior may return a different type assignable to the common
+		// one, convert its results so that they can be raced
+		indexedType := reflect.FuncOf(prior.resultType, outputs, false)
+		prependIndex := reflect.MakeFunc(indexedType, func(results []reflect.Value) []reflect.Value {
+			indexedResults := []reflect.Value{index}
+			for j, result := range results {
+				common := reflect.New(resultType[j]).Elem()
+				common.Set(result)
+				indexedResults = append(indexedResults, common)
 			}
-		}
+			return indexedResults
+		})
+		indexed[i] = prior.Then(prependIndex.Interface())
 	}
+	return Any(indexed...)
+}
 
-	p := &Promise{
-		cond:    sync.Cond{L: &sync.Mutex{}},
-		t:       anyCall,
-		anyErrs: make([]error, len(promises)),
+// Some returns a promise that resolves once n of the passed promises succeed,
+// or fails once so many have failed that n successes are impossible. All of
+// the supplied promises must be of the same type, as for Race. The promise
+// resolves with the results of the first n successful promises concatenated
+// in completion order, so promises with a single result of type T can be
+// waited into a *[]T.
+func Some(n int, promises ...*Promise) *Promise {
+	checkPromises(promises)
+	if n < 0 || n > len(promises) {
+		panic(errors.Errorf("Some requires between 0 and %d successes, got %d", len(promises), n))
 	}
+	if n == 0 {
+		return New(empty)
+	}
+
+	resultType := sameResultType("Some", promises)
+
+	p := newPromise(someCall)
+	p.priors = promises
 
 	// Extract the type
-	p.resultType = firstResultType[:]
+	p.resultType = make([]reflect.Type, 0, n*len(resultType))
+	for i := 0; i < n; i++ {
+		p.resultType = append(p.resultType, resultType...)
+	}
 
-	p.counter = int64(1)
-	p.errCounter = int64(len(promises))
+	p.counter = int64(n)
+	p.errCounter = int64(len(promises) - n + 1)
 
 	for i := range promises {
-		go p.run(reflect.Value{}, nil, promises, i, nil)
+		p.start(reflect.Value{}, nil, promises, i, nil)
 	}
 	return p
 }
@@ -253,48 +712,164 @@ func getResultType(outFunc reflect.Type) (resultType []reflect.Type, returnsErro
 
 // New returns a promise that resolves when f completes. Any panic()
 // encountered will be returned as an error from Wait()
+//
+// If the last return value of f is of type error, it is not treated as a
+// result; a non-nil error fails the promise instead. An error interface
+// holding a typed nil pointer is considered nil. A trailing concrete error
+// type such as *MyErr is an ordinary result, not an error.
+//
+// Results that are themselves functions, such as a thunk computing a value
+// lazily, are ordinary results as well: they are passed on as is and never
+// invoked by the promise. Chain a Then that calls the thunk to evaluate it.
+//
+// f may be any func value, including a bound method value such as
+// myStruct.DoWork, which behaves identically to a plain func. A method
+// expression such as (*MyStruct).DoWork takes its receiver as the first
+// argument. See NewMethod to look up a method by name.
 func New(f interface{}, args ...interface{}) *Promise {
-	// Extract the type
-	p := &Promise{
-		cond: sync.Cond{L: new(sync.Mutex)},
-		t:    simpleCall,
+	return newCall("New", reflect.ValueOf(f), args)
+}
+
+// checkFunction panics with a clear error unless the argument passed to caller
+// is a non-nil function.
+func checkFunction(caller string, functionRv reflect.Value) {
+	checkNilFunction(caller, functionRv)
+	if functionRv.Kind() != reflect.Func {
+		panic(errors.Errorf("expected Function, got %v", functionRv.Kind()))
 	}
+}
 
-	functionRv := reflect.ValueOf(f)
+// checkNilFunction panics with a clear error if the function passed to caller
+// is nil, either untyped or a nil func value, such as an uninitialized
+// function variable.
+func checkNilFunction(caller string, functionRv reflect.Value) {
+	if !functionRv.IsValid() || (functionRv.Kind() == reflect.Func && functionRv.IsNil()) {
+		panic(errors.Errorf("%s: function argument is nil", caller))
+	}
+}
 
-	if functionRv.Kind() != reflect.Func {
-		panic(errors.Errorf("expected Function, got %s", functionRv.Kind()))
+// NewMethod returns a promise that resolves when the exported method of
+// receiver with the given name completes, called with args. It is equivalent
+// to calling New with the bound method value.
+func NewMethod(receiver interface{}, method string, args ...interface{}) *Promise {
+	receiverRv := reflect.ValueOf(receiver)
+	if !receiverRv.IsValid() {
+		panic(errors.Errorf("receiver for method %s is nil", method))
+	}
+	methodRv := receiverRv.MethodByName(method)
+	if !methodRv.IsValid() {
+		panic(errors.Errorf("type %s has no exported method %s", receiverRv.Type(), method))
+	}
+	return newCall("NewMethod", methodRv, args)
+}
+
+// NewValue is like New, but takes a function and arguments that have already
+// been reflected on, such as functions built with reflect.MakeFunc. Each
+// argument must be assignable to the corresponding parameter of fv.
+func NewValue(fv reflect.Value, args ...reflect.Value) *Promise {
+	pr := prepare("NewValue", fv)
+	if len(args) != len(pr.inputs) {
+		panic(errors.Errorf("expected %d args, got %d args", len(pr.inputs), len(args)))
 	}
+	for i, arg := range args {
+		if !arg.IsValid() {
+			panic(errors.Errorf("for argument %d: expected type %s got invalid Value", i, pr.inputs[i]))
+		}
+		if !arg.Type().AssignableTo(pr.inputs[i]) {
+			panic(errors.Errorf("for argument %d: expected type %s got type %s", i, pr.inputs[i], arg.Type()))
+		}
+	}
+	p := pr.promise(nil)
+	p.start(pr.functionRv, nil, nil, 0, append([]reflect.Value(nil), args...))
+	return p
+}
+
+func newCall(caller string, functionRv reflect.Value, args []interface{}) *Promise {
+	pr := prepare(caller, functionRv)
+	return pr.Call(args...)
+}
+
+// Prepared is a function that has been reflected on and validated once, so
+// that promises can be created from it repeatedly with less overhead than New.
+type Prepared struct {
+	functionRv   reflect.Value
+	inputs       []reflect.Type
+	resultType   []reflect.Type
+	returnsError bool
+}
+
+// Prepare reflects on and validates f once. Calling the returned Prepared is
+// equivalent to calling New with f, which is useful when the same function is
+// promised in a hot loop.
+func Prepare(f interface{}) *Prepared {
+	pr := prepare("Prepare", reflect.ValueOf(f))
+	return &pr
+}
+
+// prepare reflects on and validates the function passed to caller.
+func prepare(caller string, functionRv reflect.Value) Prepared {
+	checkFunction(caller, functionRv)
 
 	reflectType := functionRv.Type()
 
-	inputs := []reflect.Type{}
-	for i := 0; i < reflectType.NumIn(); i++ {
-		inputs = append(inputs, reflectType.In(i))
+	pr := Prepared{
+		functionRv: functionRv,
+		inputs:     make([]reflect.Type, reflectType.NumIn()),
 	}
-
-	if len(args) != len(inputs) {
-		panic(errors.Errorf("expected %d args, got %d args", len(inputs), len(args)))
+	for i := range pr.inputs {
+		pr.inputs[i] = reflectType.In(i)
 	}
+	pr.resultType, pr.returnsError = getResultType(reflectType)
+	return pr
+}
 
-	p.resultType, p.returnsError = getResultType(reflectType)
+// Call returns a promise that resolves when the prepared function, called
+// with args, completes. See New.
+func (pr *Prepared) Call(args ...interface{}) *Promise {
+	return pr.call(nil, args)
+}
 
-	argValues := []reflect.Value{}
+func (pr *Prepared) call(ctx context.Context, args []interface{}) *Promise {
+	p, argValues := pr.bind(ctx, args)
+	p.start(pr.functionRv, nil, nil, 0, argValues)
+	return p
+}
+
+// bind validates args against the prepared function and returns a promise
+// for the call that has not been started yet.
+func (pr *Prepared) bind(ctx context.Context, args []interface{}) (*Promise, []reflect.Value) {
+	p := pr.promise(ctx)
+
+	if len(args) != len(pr.inputs) {
+		panic(errors.Errorf("expected %d args, got %d args", len(pr.inputs), len(args)))
+	}
+
+	argValues := make([]reflect.Value, len(args))
 
 	for i := 0; i < len(args); i++ {
 		providedArgRv := reflect.ValueOf(args[i])
 		providedArgType := providedArgRv.Type()
-		if providedArgType != inputs[i] {
-			panic(errors.Errorf("for argument %d: expected type %s got type %s", i, inputs[i], providedArgType))
+		if providedArgType != pr.inputs[i] {
+			panic(errors.Errorf("for argument %d: expected type %s got type %s", i, pr.inputs[i], providedArgType))
 		}
-		argValues = append(argValues, providedArgRv)
+		argValues[i] = providedArgRv
 	}
-	go p.run(functionRv, nil, nil, 0, argValues)
+	return p, argValues
+}
+
+// promise returns a promise for a call of the prepared function that has not
+// been started yet.
+func (pr *Prepared) promise(ctx context.Context) *Promise {
+	// Extract the type
+	p := newPromise(simpleCall)
+	p.resultType = pr.resultType
+	p.returnsError = pr.returnsError
+	p.ctx = ctx
 	return p
 }
 
 func (p *Promise) simpleCall(functionRv reflect.Value, argValues []reflect.Value) []reflect.Value {
-	return functionRv.Call(argValues)
+	return p.call(functionRv, argValues)
 }
 
 func (p *Promise) thenCall(prior *Promise, functionRv reflect.Value) []reflect.Value {
@@ -303,91 +878,408 @@ func (p *Promise) thenCall(prior *Promise, functionRv reflect.Value) []reflect.V
 		prior.cond.Wait()
 	}
 	prior.cond.L.Unlock()
-	if p.err != nil {
-		panic(errors.Wrap(p.err, "error in previous promise"))
-	}
 	if prior.err != nil {
 		panic(prior.err)
 	}
-	results := functionRv.Call(prior.results)
+	results := p.call(functionRv, prior.results)
 	return results
 }
 
 // Then returns a promise that begins execution when this Promise completes
+//
+// f must accept the results of this Promise. A variadic f may absorb trailing
+// results of its element type. An f accepting a single []T parameter absorbs
+// all of the results if they are all of type T, like the slice special case
+// of Wait, unless the only result is itself a []T, which is passed as is.
+//
+// If this Promise fails, f is not called and the returned promise fails with
+// the same error, unwrapped, whether it was returned or raised by a panic.
 func (p *Promise) Then(f interface{}) *Promise {
+	next, functionRv := p.then(f)
+	next.start(functionRv, p, nil, 0, nil)
+	return next
+}
+
+// then validates f as a continuation of p and returns the promise for it,
+// along with the function to start it with.
+func (p *Promise) then(f interface{}) (*Promise, reflect.Value) {
+	functionRv := reflect.ValueOf(f)
+	checkFunction("Then", functionRv)
+
 	// Extract the type
-	next := &Promise{
-		cond: sync.Cond{L: &sync.Mutex{}},
-		t:    thenCall,
+	resultType, returnsError := getResultType(functionRv.Type())
+	functionRv = p.continuation(functionRv)
+
+	next := p.chain(thenCall)
+	next.resultType, next.returnsError = resultType, returnsError
+	return next, functionRv
+}
+
+// continuation panics unless functionRv can be called with the results of p,
+// and returns it adapted to take them, packing them into a slice if it
+// absorbs them.
+func (p *Promise) continuation(functionRv reflect.Value) reflect.Value {
+	reflectType := functionRv.Type()
+	if p.absorbsIntoSlice(reflectType) {
+		functionRv = packSlice(functionRv, p.resultType)
+		reflectType = functionRv.Type()
 	}
 
-	functionRv := reflect.ValueOf(f)
+	p.checkContinuation(reflectType)
+	return functionRv
+}
 
-	if functionRv.Kind() != reflect.Func {
-		panic(errors.Errorf("expected Function, got %v", functionRv.Kind()))
+// chain returns a new promise of type t that continues p: it inherits the
+// context of p and is one step deeper in the chain. It panics before creating
+// the promise if the chain would exceed the limit set with SetMaxChainDepth,
+// so callers validate their arguments first and only call it once nothing
+// else can fail.
+func (p *Promise) chain(t promiseType) *Promise {
+	depth := p.depth + 1
+	if limit := atomic.LoadInt64(&maxChainDepth); limit > 0 && int64(depth) > limit {
+		panic(errors.Errorf("chain depth %d exceeds the limit of %d set with SetMaxChainDepth", depth, limit))
 	}
+	next := newPromise(t)
+	next.ctx = p.ctx
+	next.depth = depth
+	return next
+}
 
-	reflectType := functionRv.Type()
+// absorbsIntoSlice reports whether a function of type reflectType takes a
+// single []T parameter that should absorb all of the results of p. It panics
+// with a clear error if the results are not all of type T.
+func (p *Promise) absorbsIntoSlice(reflectType reflect.Type) bool {
+	if reflectType.NumIn() != 1 || reflectType.IsVariadic() {
+		return false
+	}
+	slice := reflectType.In(0)
+	if slice.Kind() != reflect.Slice {
+		return false
+	}
+	if len(p.resultType) == 1 && p.resultType[0] == slice {
+		// The promise resolves with a slice, pass it as is
+		return false
+	}
+	p.checkSliceElem(slice)
+	return true
+}
+
+// checkSliceElem panics with a clear error unless all of the results of p
+// have the element type of slice.
+func (p *Promise) checkSliceElem(slice reflect.Type) {
+	for i, resultType := range p.resultType {
+		if resultType != slice.Elem() {
+			panic(errors.Errorf("promise returns %s, which cannot be absorbed by slice parameter of type %s: result %d has type %s", typeList(p.resultType), slice, i, resultType))
+		}
+	}
+}
 
-	inputs := []reflect.Type{}
-	for i := 0; i < reflectType.NumIn(); i++ {
-		inputs = append(inputs, reflectType.In(i))
+// ThenSlice is like Then, but always passes the results of this Promise to f
+// as a single freshly made []T, even if the only result is itself a slice.
+// f must accept a single []T, and the results must all be of type T, such as
+// those of All over promises returning a T.
+func (p *Promise) ThenSlice(f interface{}) *Promise {
+	functionRv := reflect.ValueOf(f)
+	checkFunction("ThenSlice", functionRv)
+	reflectType := functionRv.Type()
+	if reflectType.NumIn() != 1 || reflectType.IsVariadic() || reflectType.In(0).Kind() != reflect.Slice {
+		panic(errors.Errorf("provided function must accept a single slice, got %s", reflectType))
 	}
-	outputs := []reflect.Type{}
-	for i := 0; i < reflectType.NumOut(); i++ {
-		outputs = append(outputs, reflectType.Out(i))
+	p.checkSliceElem(reflectType.In(0))
+	next, packedRv := p.then(packSlice(functionRv, p.resultType).Interface())
+	next.start(packedRv, p, nil, 0, nil)
+	return next
+}
+
+// packSlice adapts functionRv, which takes a single slice parameter, into a
+// function taking resultType as separate parameters.
+func packSlice(functionRv reflect.Value, resultType []reflect.Type) reflect.Value {
+	reflectType := functionRv.Type()
+	outputs := make([]reflect.Type, reflectType.NumOut())
+	for i := range outputs {
+		outputs[i] = reflectType.Out(i)
 	}
+	sliceType := reflectType.In(0)
+	return reflect.MakeFunc(reflect.FuncOf(resultType, outputs, false), func(args []reflect.Value) []reflect.Value {
+		slice := reflect.MakeSlice(sliceType, len(args), len(args))
+		for i, arg := range args {
+			slice.Index(i).Set(arg)
+		}
+		return functionRv.Call([]reflect.Value{slice})
+	})
+}
 
-	next.resultType, next.returnsError = getResultType(reflectType)
+// checkContinuation panics unless a function of type reflectType can be called
+// with the results of p.
+func (p *Promise) checkContinuation(reflectType reflect.Type) {
+	// Leave room for a variadic tail absorbing the remaining results
+	size := reflectType.NumIn()
+	if len(p.resultType) > size {
+		size = len(p.resultType)
+	}
+	inputs := make([]reflect.Type, reflectType.NumIn(), size)
+	for i := range inputs {
+		inputs[i] = reflectType.In(i)
+	}
 
 	// Check for variadic function
+	fixed := len(inputs)
 	if reflectType.IsVariadic() {
-		// If it's variadic, adjust the inputs to match if possible
-		argDiff := len(p.resultType) - len(inputs)
-		switch {
-		case argDiff == -1:
-			// Skipping the variadic arg
-			// TODO: better error message fo r variadic args
-			inputs = inputs[:len(inputs)-1]
-		case argDiff > 0:
-			var variadic reflect.Type
-			variadic, inputs = inputs[len(inputs)-1], inputs[:len(inputs)-1]
-			for i := 0; i <= argDiff; i++ {
-				// Hack: specialize the function to match the length of the incoming arguments
-				inputs = append(inputs, variadic.Elem())
-			}
+		// Specialize the function to the incoming results: the fixed
+		// parameters consume the leading results and the variadic tail
+		// consumes exactly the remaining ones, which may be none. This lets
+		// a single variadic parameter absorb a homogeneous result list, such
+		// as the results of All.
+		fixed = len(inputs) - 1
+		if len(p.resultType) < fixed {
+			panic(errors.Errorf("promise returns %d values %s, but provided variadic function requires at least %d args %s", len(p.resultType), typeList(p.resultType), fixed, typeList(inputs[:fixed])))
+		}
+		variadic := inputs[fixed]
+		inputs = inputs[:fixed]
+		for i := fixed; i < len(p.resultType); i++ {
+			inputs = append(inputs, variadic.Elem())
 		}
 	}
 
 	if len(inputs) != len(p.resultType) {
-		panic(errors.Errorf("promise returns %d values, but provided function accepts %d args", len(p.resultType), len(inputs)))
+		panic(errors.Errorf("promise returns %d values %s, but provided function accepts %d args %s", len(p.resultType), typeList(p.resultType), len(inputs), typeList(inputs)))
+	}
+
+	// Report every mismatched position at once
+	var mismatches []string
+	for i := 0; i < len(p.resultType); i++ {
+		if inputs[i] == p.resultType[i] {
+			continue
+		}
+		if i >= fixed {
+			mismatches = append(mismatches, fmt.Sprintf("for argument %d: variadic parameter of type ...%s cannot accept result of type %s, all results it absorbs must share its element type", i, inputs[i], p.resultType[i]))
+			continue
+		}
+		mismatches = append(mismatches, fmt.Sprintf("for argument %d: expected type %s got type %s", i, p.resultType[i], inputs[i]))
+	}
+	if len(mismatches) > 0 {
+		panic(errors.New(strings.Join(mismatches, "; ")))
+	}
+}
+
+// typeList formats types as a parenthesized, comma separated list.
+func typeList(types []reflect.Type) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.String()
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func (p *Promise) tapCall(prior *Promise, functionRv reflect.Value) []reflect.Value {
+	prior.cond.L.Lock()
+	for !prior.complete {
+		prior.cond.Wait()
+	}
+	prior.cond.L.Unlock()
+	if prior.err != nil {
+		panic(prior.err)
+	}
+	p.call(functionRv, prior.results)
+	return prior.results
+}
+
+// Tap returns a promise that calls f with the results of this Promise once it
+// completes, then resolves with those same results. f must accept this
+// promise's result types and return nothing, which makes Tap convenient for
+// logging and metrics inside a chain. If f panics, the returned promise fails.
+func (p *Promise) Tap(f interface{}) *Promise {
+	functionRv := reflect.ValueOf(f)
+
+	checkFunction("Tap", functionRv)
+
+	reflectType := functionRv.Type()
+
+	if reflectType.NumOut() != 0 {
+		panic(errors.Errorf("provided function must not return values, got %d return values", reflectType.NumOut()))
+	}
+
+	p.checkContinuation(reflectType)
+	next := p.chain(tapCall)
+	next.resultType = p.resultType
+	next.start(functionRv, p, nil, 0, nil)
+	return next
+}
+
+// ThenOr returns a promise that calls f with the results of this Promise if it
+// succeeds, like Then. If this Promise fails, the returned promise resolves
+// with the values returned by fallback instead of failing. fallback must
+// accept no arguments and return the same types as f.
+func (p *Promise) ThenOr(f interface{}, fallback interface{}) *Promise {
+	functionRv := reflect.ValueOf(f)
+	checkFunction("ThenOr", functionRv)
+	fallbackRv := reflect.ValueOf(fallback)
+	checkNilFunction("ThenOr", fallbackRv)
+	if fallbackRv.Kind() != reflect.Func {
+		panic(errors.Errorf("expected Function for fallback, got %v", fallbackRv.Kind()))
+	}
+
+	reflectType := functionRv.Type()
+	p.checkContinuation(reflectType)
+
+	fallbackType := fallbackRv.Type()
+	if fallbackType.NumIn() != 0 {
+		panic(errors.Errorf("fallback must not accept arguments, got %d args", fallbackType.NumIn()))
+	}
+	outputs := make([]reflect.Type, reflectType.NumOut())
+	for i := range outputs {
+		outputs[i] = reflectType.Out(i)
+	}
+	fallbackOutputs := make([]reflect.Type, fallbackType.NumOut())
+	for i := range fallbackOutputs {
+		fallbackOutputs[i] = fallbackType.Out(i)
+	}
+	if !reflect.DeepEqual(outputs, fallbackOutputs) {
+		panic(errors.Errorf("function returns %s, but fallback returns %s", typeList(outputs), typeList(fallbackOutputs)))
+	}
+
+	inputs := append(append([]reflect.Type{}, p.resultType...), errorType)
+	thenOr := reflect.MakeFunc(reflect.FuncOf(inputs, outputs, false), func(args []reflect.Value) []reflect.Value {
+		if !args[len(args)-1].IsNil() {
+			return fallbackRv.Call(nil)
+		}
+		return functionRv.Call(args[:len(args)-1])
+	})
+	return p.ThenErr(thenOr.Interface())
+}
+
+// Catch returns a promise that resolves with the results of this Promise if it
+// succeeds. If this Promise fails, f is called with the error and the returned
+// promise resolves with the values returned by f instead. f must accept a
+// single error and return the same types as this promise, optionally followed
+// by an error to fail the returned promise.
+func (p *Promise) Catch(f interface{}) *Promise {
+	functionRv := reflect.ValueOf(f)
+	checkFunction("Catch", functionRv)
+
+	reflectType := functionRv.Type()
+	if reflectType.NumIn() != 1 || reflectType.In(0) != errorType {
+		panic(errors.New("provided function must accept a single error"))
+	}
+	resultType, returnsError := getResultType(reflectType)
+	if !reflect.DeepEqual(resultType, p.resultType) && (len(resultType) != 0 || len(p.resultType) != 0) {
+		panic(errors.Errorf("promise returns %s, but provided function returns %s", typeList(p.resultType), typeList(resultType)))
+	}
+
+	inputs := append(append([]reflect.Type{}, p.resultType...), errorType)
+	outputs := make([]reflect.Type, reflectType.NumOut())
+	for i := range outputs {
+		outputs[i] = reflectType.Out(i)
+	}
+	catch := reflect.MakeFunc(reflect.FuncOf(inputs, outputs, false), func(args []reflect.Value) []reflect.Value {
+		errRv := args[len(args)-1]
+		if !errRv.IsNil() {
+			return functionRv.Call([]reflect.Value{errRv})
+		}
+		if returnsError {
+			return args
+		}
+		return args[:len(args)-1]
+	})
+	return p.ThenErr(catch.Interface())
+}
+
+// ThenWith returns a promise that calls f with this Promise itself once it
+// completes, whether it succeeded or failed, so that f can inspect it, for
+// instance its Name or Duration, and Wait on it without blocking. f must
+// accept a single *Promise; its return values become the results of the
+// returned promise as with Then, including a trailing error.
+func (p *Promise) ThenWith(f interface{}) *Promise {
+	functionRv := reflect.ValueOf(f)
+	checkFunction("ThenWith", functionRv)
+	reflectType := functionRv.Type()
+	if reflectType.NumIn() != 1 || reflectType.In(0) != promisePtrType {
+		panic(errors.Errorf("provided function must accept a single %s", promisePtrType))
+	}
+
+	inputs := append(append([]reflect.Type{}, p.resultType...), errorType)
+	outputs := make([]reflect.Type, reflectType.NumOut())
+	for i := range outputs {
+		outputs[i] = reflectType.Out(i)
+	}
+	priorRv := reflect.ValueOf(p)
+	with := reflect.MakeFunc(reflect.FuncOf(inputs, outputs, false), func([]reflect.Value) []reflect.Value {
+		return functionRv.Call([]reflect.Value{priorRv})
+	})
+	return p.ThenErr(with.Interface())
+}
+
+// zeroResults returns the zero value of each of types, to stand in for the
+// results of a promise whose function did not run.
+func zeroResults(types []reflect.Type) []reflect.Value {
+	results := make([]reflect.Value, len(types))
+	for i, t := range types {
+		results[i] = reflect.Zero(t)
+	}
+	return results
+}
+
+var promisePtrType = reflect.TypeOf((*Promise)(nil))
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func (p *Promise) thenErrCall(prior *Promise, functionRv reflect.Value) []reflect.Value {
+	prior.cond.L.Lock()
+	for !prior.complete {
+		prior.cond.Wait()
+	}
+	prior.cond.L.Unlock()
+	args := make([]reflect.Value, 0, len(prior.resultType)+1)
+	errRv := reflect.New(errorType).Elem()
+	if prior.err != nil {
+		args = append(args, zeroResults(prior.resultType)...)
+		errRv.Set(reflect.ValueOf(prior.err))
+	} else {
+		args = append(args, prior.results...)
+	}
+	args = append(args, errRv)
+	return p.call(functionRv, args)
+}
+
+// ThenErr returns a promise that begins execution when this Promise completes,
+// whether it succeeded or failed. f must accept this promise's result types
+// followed by an error. If this promise failed, f receives zero values for the
+// results and the non-nil error, allowing it to recover inline in a chain.
+func (p *Promise) ThenErr(f interface{}) *Promise {
+	functionRv := reflect.ValueOf(f)
+
+	checkFunction("ThenErr", functionRv)
+
+	reflectType := functionRv.Type()
+
+	if reflectType.NumIn() != len(p.resultType)+1 {
+		panic(errors.Errorf("promise returns %d values, provided function must accept %d args followed by an error", len(p.resultType), len(p.resultType)))
 	}
 
 	for i := 0; i < len(p.resultType); i++ {
-		if inputs[i] != p.resultType[i] {
-			panic(errors.Errorf("for argument %d: expected type %s got type %s", i, p.resultType[i], inputs[i]))
+		if reflectType.In(i) != p.resultType[i] {
+			panic(errors.Errorf("for argument %d: expected type %s got type %s", i, p.resultType[i], reflectType.In(i)))
 		}
 	}
-	go next.run(functionRv, p, nil, 0, nil)
+
+	if lastIn := reflectType.In(len(p.resultType)); lastIn != errorType {
+		panic(errors.Errorf("for argument %d: expected type %s got type %s", len(p.resultType), errorType, lastIn))
+	}
+
+	next := p.chain(thenErrCall)
+	next.resultType, next.returnsError = getResultType(reflectType)
+
+	next.start(functionRv, p, nil, 0, nil)
 	return next
 }
 
 func (p *Promise) run(functionRv reflect.Value, prior *Promise, priors []*Promise, index int, args []reflect.Value) {
+	addInFlight(1)
+	defer addInFlight(-1)
 	// Catch panics
 	defer func() {
 		if r := recover(); r != nil {
-			err, ok := r.(error)
-			if !ok {
-				err = errors.Errorf("%+v", r)
-			}
-			p.cond.L.Lock()
-			defer p.cond.L.Unlock()
-			if p.complete {
-				return
-			}
-			p.err = err
-			p.complete = true
-			p.cond.Broadcast()
+			p.settle(nil, recovered(r))
 		}
 	}()
 	var results []reflect.Value
@@ -396,74 +1288,187 @@ func (p *Promise) run(functionRv reflect.Value, prior *Promise, priors []*Promis
 		results = p.simpleCall(functionRv, args)
 	case thenCall:
 		results = p.thenCall(prior, functionRv)
-	case allCall:
-		results = p.allCall(priors, index)
-		if results == nil {
-			return
+	case thenErrCall:
+		results = p.thenErrCall(prior, functionRv)
+	case tapCall:
+		results = p.tapCall(prior, functionRv)
+	case allCall, anyCall, raceCall, someCall:
+		// Only the waiter that completes the combinator settles it; an
+		// empty results slice is valid for promises without results.
+		var ok bool
+		switch p.t {
+		case allCall:
+			results, ok = p.allCall(priors, index)
+		case anyCall:
+			results, ok = p.anyCall(priors, index)
+		case someCall:
+			results, ok = p.someCall(priors, index)
+		default:
+			results, ok = p.raceCall(priors, index)
 		}
-	case anyCall:
-		results = p.anyCall(priors, index)
-		if results == nil {
+		if !ok {
 			return
 		}
-	case raceCall:
-		results = p.raceCall(priors, index)
 	default:
 		panic("unexpected call type")
 	}
-	p.cond.L.Lock()
-	defer p.cond.L.Unlock()
+	var err error
 	if p.returnsError {
 		var lastResult reflect.Value
 		lastResult, results = results[len(results)-1], results[:len(results)-1]
-		if !lastResult.IsNil() {
-			err, ok := lastResult.Interface().(error)
+		if !isNilError(lastResult) {
+			var ok bool
+			err, ok = lastResult.Interface().(error)
 			if !ok {
 				panic("Expected to find error")
 			}
-			p.err = err
 		}
 	}
-	p.complete = true
+	p.settle(results, err)
+}
+
+// settle completes the promise with results and err, wakes any waiters and
+// then calls the registered callbacks outside of the lock. Only the first call
+// has any effect, later results (e.g. the losers of a Race) are discarded.
+func (p *Promise) settle(results []reflect.Value, err error) {
+	p.cond.L.Lock()
+	if p.complete {
+		p.cond.L.Unlock()
+		return
+	}
+	if err == nil && results == nil {
+		// Resolved without running a function, keep the type contract
+		results = zeroResults(p.resultType)
+	}
+	p.err = err
 	p.results = results
+	p.completeAndUnlock()
+	if err != nil {
+		p.reportUnhandled()
+	}
+}
+
+// completeAndUnlock marks the promise complete, wakes any waiters, releases
+// the lock and then calls the registered callbacks. The lock must be held.
+func (p *Promise) completeAndUnlock() {
+	p.complete = true
+	callbacks := p.callbacks
+	p.callbacks = nil
+	err := p.err
+	name, state := p.name, p.state()
+	if p.done != nil {
+		close(p.done)
+	}
 	p.cond.Broadcast()
+	p.cond.L.Unlock()
+	p.emit(EventSettled, name, Pending, state)
+	for _, f := range callbacks {
+		f(err)
+	}
 }
 
-func (p *Promise) getBareWaitRVs(out ...interface{}) []reflect.Value {
-	outRvs := []reflect.Value{}
-	if len(p.resultType) != len(out) {
-		panic(errors.Errorf("Promise returns %d values, Wait was asked to set %d values", len(p.resultType), len(out)))
+// OnComplete registers f to be called with the promise's error (nil on
+// success) once it settles, without blocking a goroutine on Wait. If the
+// promise has already settled, f is called synchronously. Otherwise f is called
+// from the goroutine that settles the promise. Callbacks run without any lock
+// held, so they may call back into the promise.
+func (p *Promise) OnComplete(f func(err error)) {
+	p.observe()
+	p.onComplete(f)
+}
+
+// onComplete is like OnComplete, but does not mark the error of the promise
+// as handled, for callbacks that only track the promise, see
+// SetUnhandledHandler.
+func (p *Promise) onComplete(f func(err error)) {
+	p.demand()
+	p.cond.L.Lock()
+	if !p.complete {
+		p.callbacks = append(p.callbacks, f)
+		p.cond.L.Unlock()
+		return
 	}
-	for i := 0; i < len(out); i++ {
-		outRv := reflect.ValueOf(out[i])
-		outRvs = append(outRvs, outRv)
-		outType := outRv.Type()
-		if outType != reflect.PtrTo(p.resultType[i]) {
-			panic(errors.Errorf("for return value %d: expected pointer to %s got type %s", i, p.resultType[i], outType))
-		}
+	err := p.err
+	p.cond.L.Unlock()
+	f(err)
+}
+
+// isNilError reports whether the trailing error returned by a promise
+// function should be treated as nil. An error interface holding a typed nil
+// (e.g. a nil *MyErr returned as error) is not == nil in Go, but it carries no
+// error either, so the promise resolves successfully rather than failing with
+// an error whose Error method would likely dereference nil.
+func isNilError(errRv reflect.Value) bool {
+	if errRv.IsNil() {
+		return true
+	}
+	switch inner := errRv.Elem(); inner.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+		return inner.IsNil()
 	}
-	return outRvs
+	return false
 }
 
-func validSliceReturn(resultType []reflect.Type, args []interface{}) (elem reflect.Type, ok bool) {
-	if len(resultType) == 0 {
-		return nil, false
+// WithName labels the promise with name for debugging and returns the promise.
+// The name is included in the errors returned for the promise, such as
+// "error during promise execution [name]".
+func (p *Promise) WithName(name string) *Promise {
+	p.cond.L.Lock()
+	p.name = name
+	p.cond.L.Unlock()
+	return p
+}
+
+// Name returns the label set with WithName, or an empty string.
+func (p *Promise) Name() string {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	return p.name
+}
+
+// label appends the name of the promise, if it has one, to msg.
+func (p *Promise) label(msg string) string {
+	name := p.Name()
+	if name == "" {
+		return msg
 	}
+	return fmt.Sprintf("%s [%s]", msg, name)
+}
+
+// ResultTypes returns the types of the values the promise resolves with, in
+// order. A trailing error return is not included, see ReturnsError. The
+// returned slice is a copy and may be modified freely.
+func (p *Promise) ResultTypes() []reflect.Type {
+	resultType := make([]reflect.Type, len(p.resultType))
+	copy(resultType, p.resultType)
+	return resultType
+}
+
+// ReturnsError reports whether the function of the promise returns a trailing
+// error, which is stripped from its results.
+func (p *Promise) ReturnsError() bool {
+	return p.returnsError
+}
+
+// outPointer returns the reflect.Value of the out argument at index i, panicking
+// with a clear error if it is nil rather than failing deep inside reflect.
+func outPointer(i int, out interface{}) reflect.Value {
+	outRv := reflect.ValueOf(out)
+	if !outRv.IsValid() || (outRv.Kind() == reflect.Ptr && outRv.IsNil()) {
+		panic(errors.Errorf("out argument %d is a nil pointer", i))
+	}
+	return outRv
+}
+
+func validSliceReturn(resultType []reflect.Type, args []interface{}) (elem reflect.Type, ok bool) {
 	if len(args) != 1 {
 		// we're only interested in single slice value
 		return nil, false
 	}
 
-	// Check that there is only one result type
-	resultElem := resultType[0]
-	for _, result := range resultType[1:] {
-		if result != resultElem {
-			return nil, false
-		}
-	}
 	arg := args[0]
 	argType := reflect.TypeOf(arg)
-	if argType.Kind() != reflect.Ptr {
+	if argType == nil || argType.Kind() != reflect.Ptr {
 		return nil, false
 	}
 	slice := argType.Elem()
@@ -471,6 +1476,19 @@ func validSliceReturn(resultType []reflect.Type, args []interface{}) (elem refle
 		return nil, false
 	}
 	elem = slice.Elem()
+
+	// Without results any slice can hold all of them, it is left empty
+	if len(resultType) == 0 {
+		return elem, true
+	}
+
+	// Check that there is only one result type
+	resultElem := resultType[0]
+	for _, result := range resultType[1:] {
+		if result != resultElem {
+			return nil, false
+		}
+	}
 	if elem != resultElem {
 		return nil, false
 	}
@@ -479,54 +1497,82 @@ func validSliceReturn(resultType []reflect.Type, args []interface{}) (elem refle
 
 // Wait blocks until the promise finishes execution or panics.
 // If the promise panics, wait wraps the panic and returns an error.
+//
+// Each out argument must be a pointer to a type the corresponding result is
+// assignable to, so a concrete result may be bound to a pointer to an
+// interface it implements.
+//
+// Results are bound as is, so every Wait on the same promise receives the
+// same slices, maps and pointers, and a change made through one is seen
+// through the others. Use WaitCopy to receive copies of slices and maps.
 func (p *Promise) Wait(out ...interface{}) error {
+	bind := p.binder(out)
+	p.outcome()
+	return p.bindResults(bind)
+}
+
+// binder validates the out arguments of Wait against the result types of the
+// promise and returns a function that binds results to them.
+func (p *Promise) binder(out []interface{}) func(results []reflect.Value) {
 	// Check for slice special case
 
 	sliceReturnType, isSliceReturn := validSliceReturn(p.resultType, out)
 
-	if !isSliceReturn {
+	if isSliceReturn {
+		outPointer(0, out[0])
+	} else {
 		if len(p.resultType) != len(out) {
 			panic(errors.Errorf("Promise returns %d values, Wait was asked to set %d values", len(p.resultType), len(out)))
 		}
 		for i := 0; i < len(out); i++ {
-			outRv := reflect.ValueOf(out[i])
+			outRv := outPointer(i, out[i])
 			outType := outRv.Type()
-			if outType != reflect.PtrTo(p.resultType[i]) {
+			if outType.Kind() != reflect.Ptr || !p.resultType[i].AssignableTo(outType.Elem()) {
 				panic(errors.Errorf("for return value %d: expected pointer to %s got type %s", i, p.resultType[i], outType))
 			}
 		}
 	}
-	p.cond.L.Lock()
-	for !p.complete {
-		p.cond.Wait()
-	}
-	p.cond.L.Unlock()
-
-	if p.err != nil {
-		return errors.Wrap(p.err, "error during promise execution")
-	}
 
-	var outRvs []reflect.Value
+	return func(results []reflect.Value) {
+		outRvs := make([]reflect.Value, 0, len(results))
 
-	if isSliceReturn {
-		slicePtr := reflect.ValueOf(out[0])
-		newSlice := reflect.MakeSlice(reflect.SliceOf(sliceReturnType), len(p.resultType), len(p.resultType))
-		slicePtr.Elem().Set(newSlice)
-		for i := 0; i < len(p.results); i++ {
-			outRv := newSlice.Index(i)
-			outRvs = append(outRvs, outRv)
+		if isSliceReturn {
+			slicePtr := reflect.ValueOf(out[0])
+			newSlice := reflect.MakeSlice(reflect.SliceOf(sliceReturnType), len(p.resultType), len(p.resultType))
+			slicePtr.Elem().Set(newSlice)
+			for i := 0; i < len(results); i++ {
+				outRv := newSlice.Index(i)
+				outRvs = append(outRvs, outRv)
+			}
+		} else {
+			for i := 0; i < len(out); i++ {
+				outRv := reflect.ValueOf(out[i])
+				outRvs = append(outRvs, outRv.Elem())
+			}
 		}
-	} else {
-		for i := 0; i < len(out); i++ {
-			outRv := reflect.ValueOf(out[i])
-			outRvs = append(outRvs, outRv.Elem())
+
+		for i := 0; i < len(results); i++ {
+			outRv := outRvs[i]
+			result := results[i]
+			outRv.Set(result)
 		}
 	}
+}
 
-	for i := 0; i < len(p.results); i++ {
-		outRv := outRvs[i]
-		result := p.results[i]
-		outRv.Set(result)
+// bindResults returns the error of the completed promise, or passes its
+// results to bind.
+func (p *Promise) bindResults(bind func(results []reflect.Value)) error {
+	if p.err != nil {
+		return p.waitError()
 	}
+	bind(p.results)
 	return nil
 }
+
+// waitError returns the error of the completed promise as returned by Wait.
+func (p *Promise) waitError() error {
+	if p.err == nil {
+		return nil
+	}
+	return wrapError(p.err, p.label("error during promise execution"))
+}
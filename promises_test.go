@@ -1,11 +1,21 @@
 package promise
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	pkgerrors "github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -284,7 +294,6 @@ func TestPromiseRaceSucceedsIfOneSucceeds(t *testing.T) {
 	sleepThenPanic := func() string {
 		time.Sleep(100 * time.Millisecond)
 		panic("failed")
-		return ""
 	}
 
 	sleepThenErr := func() (string, error) {
@@ -307,7 +316,6 @@ func TestPromiseRaceFailsIfOneErrors(t *testing.T) {
 	sleepThenPanic := func() string {
 		time.Sleep(100 * time.Millisecond)
 		panic("failed")
-		return ""
 	}
 
 	returnError := func() (string, error) {
@@ -330,7 +338,6 @@ func TestPromiseRaceFailsIfOneErrors(t *testing.T) {
 func TestPromiseRaceFailsIfOnePanics(t *testing.T) {
 	justPanic := func() string {
 		panic("failed")
-		return ""
 	}
 
 	sleepThenError := func() (string, error) {
@@ -355,7 +362,6 @@ func TestPromiseAnySucceedsIfOneSucceeds(t *testing.T) {
 	sleepThenPanic := func() string {
 		time.Sleep(100 * time.Millisecond)
 		panic("failed")
-		return ""
 	}
 
 	sleepThenErr := func() (string, error) {
@@ -378,7 +384,6 @@ func TestPromiseAnyFailsIfAllFail(t *testing.T) {
 	sleepThenPanic := func() string {
 		time.Sleep(100 * time.Millisecond)
 		panic("failed")
-		return ""
 	}
 
 	returnError := func() (string, error) {
@@ -397,3 +402,1566 @@ func TestPromiseAnyFailsIfAllFail(t *testing.T) {
 	require.Contains(t, err.Error(), "err")
 	require.Equal(t, "", retval)
 }
+
+type typedNilErr struct{}
+
+func (*typedNilErr) Error() string {
+	return "typed nil error"
+}
+
+func TestTypedNilErrorResolves(t *testing.T) {
+	p := New(func() (int, error) {
+		var err *typedNilErr
+		return 1, err
+	})
+	var resolved int
+	err := p.Wait(&resolved)
+	require.NoError(t, err, "A typed nil error should not fail the promise")
+	require.Equal(t, 1, resolved)
+}
+
+func TestTypedNonNilErrorFails(t *testing.T) {
+	p := New(func() (int, error) {
+		return 0, &typedNilErr{}
+	})
+	var resolved int
+	err := p.Wait(&resolved)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "typed nil error")
+}
+
+func TestConcreteErrorTypeIsResult(t *testing.T) {
+	p := New(func() *typedNilErr {
+		return nil
+	})
+	var resolved *typedNilErr
+	err := p.Wait(&resolved)
+	require.NoError(t, err, "A concrete error type is returned as an ordinary result")
+	require.Nil(t, resolved)
+}
+
+func TestOnCompleteAfterSettle(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	var resolved int
+	require.NoError(t, p.Wait(&resolved))
+
+	called := false
+	p.OnComplete(func(err error) {
+		require.NoError(t, err)
+		called = true
+	})
+	require.True(t, called, "OnComplete on a settled promise should run synchronously")
+}
+
+func TestOnCompleteMultipleCallbacks(t *testing.T) {
+	blocker := make(chan struct{})
+	p := New(func() error {
+		<-blocker
+		return errors.New("failed")
+	})
+
+	errs := make(chan error, 2)
+	p.OnComplete(func(err error) {
+		errs <- err
+	})
+	p.OnComplete(func(err error) {
+		// Calling back into the promise must not deadlock
+		errs <- p.Wait()
+	})
+	close(blocker)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			require.Error(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("callback was not called")
+		}
+	}
+}
+
+func TestThenErrReceivesError(t *testing.T) {
+	failing := New(func() (int, error) {
+		return 5, errors.New("failed")
+	})
+	recovered := failing.ThenErr(func(x int, err error) int {
+		require.Equal(t, 0, x, "results should be zero values when the prior failed")
+		require.Error(t, err)
+		return -1
+	})
+	var result int
+	err := recovered.Wait(&result)
+	require.NoError(t, err)
+	require.Equal(t, -1, result)
+}
+
+func TestThenErrReceivesResults(t *testing.T) {
+	succeeding := New(func() (int, string) {
+		return 5, "five"
+	})
+	next := succeeding.ThenErr(func(x int, s string, err error) string {
+		require.NoError(t, err)
+		return fmt.Sprintf("%d=%s", x, s)
+	})
+	var result string
+	err := next.Wait(&result)
+	require.NoError(t, err)
+	require.Equal(t, "5=five", result)
+}
+
+func TestThenErrValidatesSignature(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	require.Panics(t, func() {
+		p.ThenErr(func(x int) int {
+			return x
+		})
+	}, "ThenErr requires a trailing error argument")
+	require.Panics(t, func() {
+		p.ThenErr(func(x string, err error) {})
+	}, "ThenErr requires the prior's result types")
+	require.Panics(t, func() {
+		p.ThenErr(func(x int, y int) {})
+	}, "The trailing argument must be an error")
+}
+
+func TestThenVariadicExpansion(t *testing.T) {
+	sum := func(first int, rest ...int) int {
+		for _, x := range rest {
+			first += x
+		}
+		return first
+	}
+	tests := []struct {
+		name   string
+		values []int
+		want   int
+	}{
+		{name: "zero variadic args", values: []int{1}, want: 1},
+		{name: "one variadic arg", values: []int{1, 2}, want: 3},
+		{name: "many variadic args", values: []int{1, 2, 3, 4}, want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			promises := []*Promise{}
+			for _, v := range tt.values {
+				promises = append(promises, New(func(x int) int {
+					return x
+				}, v))
+			}
+			var result int
+			err := All(promises...).Then(sum).Wait(&result)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, result)
+		})
+	}
+}
+
+func TestThenVariadicTooFewResults(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	require.Panics(t, func() {
+		p.Then(func(a, b int, rest ...int) {})
+	}, "A variadic function still requires its fixed arguments")
+}
+
+func TestThenVariadicTypeMismatch(t *testing.T) {
+	p := New(func() (int, string) {
+		return 1, "one"
+	})
+	require.Panics(t, func() {
+		p.Then(func(a int, rest ...int) {})
+	}, "Every result consumed by the variadic tail must match its element type")
+}
+
+func TestAllThenVariadicHomogeneous(t *testing.T) {
+	pair := New(func() (int, int) {
+		return 1, 2
+	})
+	single := New(func() int {
+		return 3
+	})
+	collect := All(pair, single).Then(func(xs ...int) []int {
+		return xs
+	})
+	var values []int
+	err := collect.Wait(&values)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3}, values)
+}
+
+func TestAllThenVariadicEmpty(t *testing.T) {
+	collect := All().Then(func(xs ...int) int {
+		return len(xs)
+	})
+	var count int
+	err := collect.Wait(&count)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
+
+func TestAllThenVariadicHeterogeneous(t *testing.T) {
+	mixed := All(New(func() int {
+		return 1
+	}), New(func() string {
+		return "two"
+	}))
+	requirePanicsWithError(t, "for argument 1: variadic parameter of type ...int cannot accept result of type string, all results it absorbs must share its element type", func() {
+		mixed.Then(func(xs ...int) {})
+	})
+}
+
+// requirePanicsWithError asserts that f panics with an error whose message is msg
+func requirePanicsWithError(t *testing.T, msg string, f func()) {
+	t.Helper()
+	defer func() {
+		r := recover()
+		require.NotNil(t, r, "expected a panic")
+		err, ok := r.(error)
+		require.True(t, ok, "expected to panic with an error, got %v", r)
+		require.EqualError(t, err, msg)
+	}()
+	f()
+}
+
+// requireEventually asserts that condition returns true within waitFor,
+// checking every tick. It polls from the test goroutine, unlike
+// require.Eventually, whose checks can outlive it and panic.
+func requireEventually(t *testing.T, condition func() bool, waitFor time.Duration, tick time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(waitFor)
+	for !condition() {
+		if time.Now().After(deadline) {
+			require.FailNow(t, "Condition never satisfied")
+		}
+		time.Sleep(tick)
+	}
+}
+
+func TestResultTypes(t *testing.T) {
+	p := New(func() (int, string, error) {
+		return 1, "one", nil
+	})
+	require.Equal(t, []reflect.Type{reflect.TypeOf(0), reflect.TypeOf("")}, p.ResultTypes())
+	require.True(t, p.ReturnsError())
+
+	resultTypes := p.ResultTypes()
+	resultTypes[0] = reflect.TypeOf(0.0)
+	require.Equal(t, reflect.TypeOf(0), p.ResultTypes()[0], "ResultTypes should return a copy")
+
+	void := New(func() {})
+	require.Empty(t, void.ResultTypes())
+	require.False(t, void.ReturnsError())
+}
+
+func TestWaitNilOutPointer(t *testing.T) {
+	p := New(func() (int, int) {
+		return 1, 2
+	})
+	var first int
+	requirePanicsWithError(t, "out argument 1 is a nil pointer", func() {
+		p.Wait(&first, (*int)(nil))
+	})
+	requirePanicsWithError(t, "out argument 1 is a nil pointer", func() {
+		p.Wait(&first, nil)
+	})
+}
+
+func TestWaitNilSlicePointer(t *testing.T) {
+	p := All(New(func() int {
+		return 1
+	}), New(func() int {
+		return 2
+	}))
+	requirePanicsWithError(t, "out argument 0 is a nil pointer", func() {
+		p.Wait((*[]int)(nil))
+	})
+}
+
+type multiplier struct {
+	factor int
+}
+
+func (m *multiplier) Multiply(x int) int {
+	return x * m.factor
+}
+
+func (m multiplier) Factor() int {
+	return m.factor
+}
+
+func TestBoundMethodValues(t *testing.T) {
+	m := &multiplier{factor: 3}
+
+	var result int
+	err := New(m.Multiply, 2).Wait(&result)
+	require.NoError(t, err)
+	require.Equal(t, 6, result)
+
+	err = New(m.Factor).Then(m.Multiply).Wait(&result)
+	require.NoError(t, err)
+	require.Equal(t, 9, result)
+
+	var values []int
+	err = All(New(m.Multiply, 1), New(m.Multiply, 2)).Wait(&values)
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 6}, values)
+
+	err = Race(New(m.Multiply, 1), New(m.Multiply, 1)).Wait(&result)
+	require.NoError(t, err)
+	require.Equal(t, 3, result)
+
+	err = Any(New(m.Multiply, 1), New(m.Multiply, 1)).Wait(&result)
+	require.NoError(t, err)
+	require.Equal(t, 3, result)
+}
+
+func TestMethodExpression(t *testing.T) {
+	m := &multiplier{factor: 3}
+	var result int
+	err := New((*multiplier).Multiply, m, 2).Wait(&result)
+	require.NoError(t, err)
+	require.Equal(t, 6, result)
+}
+
+func TestNewMethod(t *testing.T) {
+	m := &multiplier{factor: 4}
+	var result int
+	err := NewMethod(m, "Multiply", 2).Wait(&result)
+	require.NoError(t, err)
+	require.Equal(t, 8, result)
+
+	err = NewMethod(*m, "Factor").Wait(&result)
+	require.NoError(t, err)
+	require.Equal(t, 4, result)
+
+	requirePanicsWithError(t, "type *promise.multiplier has no exported method Divide", func() {
+		NewMethod(m, "Divide", 2)
+	})
+	requirePanicsWithError(t, "receiver for method Multiply is nil", func() {
+		NewMethod(nil, "Multiply", 2)
+	})
+}
+
+func TestTapPassesResultsThrough(t *testing.T) {
+	var tapped []int
+	p := New(func() (int, int) {
+		return 1, 2
+	}).Tap(func(x, y int) {
+		tapped = append(tapped, x, y)
+	})
+	var x, y int
+	err := p.Wait(&x, &y)
+	require.NoError(t, err)
+	require.Equal(t, 1, x)
+	require.Equal(t, 2, y)
+	require.Equal(t, []int{1, 2}, tapped)
+}
+
+func TestTapPanicFailsPromise(t *testing.T) {
+	p := New(func() int {
+		return 1
+	}).Tap(func(x int) {
+		panic("tap failed")
+	})
+	var x int
+	err := p.Wait(&x)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "tap failed")
+}
+
+func TestTapValidatesSignature(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	requirePanicsWithError(t, "for argument 0: expected type int got type string", func() {
+		p.Tap(func(s string) {})
+	})
+	requirePanicsWithError(t, "provided function must not return values, got 1 return values", func() {
+		p.Tap(func(x int) int {
+			return x
+		})
+	})
+}
+
+func TestWithName(t *testing.T) {
+	p := New(func() error {
+		return errors.New("failed")
+	}).WithName("fetch")
+	require.Equal(t, "fetch", p.Name())
+
+	err := p.Wait()
+	require.EqualError(t, err, "error during promise execution [fetch]: failed")
+
+	err = All(p, New(func() {})).Wait()
+	require.EqualError(t, err, "error during promise execution: error encountered in promise [fetch]: failed")
+}
+
+func TestWithoutName(t *testing.T) {
+	p := New(func() error {
+		return errors.New("failed")
+	})
+	require.Equal(t, "", p.Name())
+	require.EqualError(t, p.Wait(), "error during promise execution: failed")
+}
+
+func TestThenTypeErrorMessages(t *testing.T) {
+	pair := New(func() (int, int) {
+		return 1, 2
+	})
+	tests := []struct {
+		name string
+		f    interface{}
+		msg  string
+	}{
+		{
+			name: "too few args",
+			f:    func(s string) {},
+			msg:  "promise returns 2 values (int, int), but provided function accepts 1 args (string)",
+		},
+		{
+			name: "too many args",
+			f:    func(a, b, c int) {},
+			msg:  "promise returns 2 values (int, int), but provided function accepts 3 args (int, int, int)",
+		},
+		{
+			name: "one mismatch",
+			f:    func(a int, b string) {},
+			msg:  "for argument 1: expected type int got type string",
+		},
+		{
+			name: "every mismatch",
+			f:    func(a float64, b string) {},
+			msg:  "for argument 0: expected type int got type float64; for argument 1: expected type int got type string",
+		},
+		{
+			name: "variadic missing fixed args",
+			f:    func(a, b, c int, rest ...int) {},
+			msg:  "promise returns 2 values (int, int), but provided variadic function requires at least 3 args (int, int, int)",
+		},
+		{
+			name: "variadic mismatch",
+			f:    func(a int, rest ...string) {},
+			msg:  "for argument 1: variadic parameter of type ...string cannot accept result of type int, all results it absorbs must share its element type",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requirePanicsWithError(t, tt.msg, func() {
+				pair.Then(tt.f)
+			})
+		})
+	}
+}
+
+func TestLongThenChainsUnderLoad(t *testing.T) {
+	const chains = 20
+	const depth = 200
+	tails := make([]*Promise, chains)
+	for c := range tails {
+		p := New(func() int {
+			return 0
+		})
+		for i := 0; i < depth; i++ {
+			p = p.Then(func(x int) int {
+				return x + 1
+			})
+		}
+		tails[c] = p
+	}
+	for _, tail := range tails {
+		var result int
+		require.NoError(t, tail.Wait(&result))
+		require.Equal(t, depth, result)
+	}
+}
+
+func TestAnyIndexedReportsWinner(t *testing.T) {
+	slow := func(x string) string {
+		time.Sleep(100 * time.Millisecond)
+		return x
+	}
+	fast := func(x string) string {
+		return x
+	}
+	result := AnyIndexed(New(slow, "primary"), New(fast, "secondary"), New(func() (string, error) {
+		return "", errors.New("failed")
+	}))
+	var index int
+	var value string
+	err := result.Wait(&index, &value)
+	require.NoError(t, err)
+	require.Equal(t, 1, index)
+	require.Equal(t, "secondary", value)
+}
+
+func TestAnyIndexedValidatesTypes(t *testing.T) {
+	require.Panics(t, func() {
+		AnyIndexed(New(func() int {
+			return 1
+		}), New(func() string {
+			return ""
+		}))
+	}, "AnyIndexed requires the same result types")
+	requirePanicsWithError(t, "AnyIndexed requires at least one promise", func() {
+		AnyIndexed()
+	})
+}
+
+func TestAllStruct(t *testing.T) {
+	var dst struct {
+		Name    string
+		Age     int
+		private bool
+		Admin   bool
+	}
+	p := AllStruct(&dst, New(func() (string, int) {
+		return "gopher", 10
+	}), New(func() bool {
+		return true
+	}))
+	err := p.Wait()
+	require.NoError(t, err)
+	require.Equal(t, "gopher", dst.Name)
+	require.Equal(t, 10, dst.Age)
+	require.True(t, dst.Admin)
+	require.False(t, dst.private)
+}
+
+func TestAllStructValidatesFields(t *testing.T) {
+	name := New(func() string {
+		return "gopher"
+	})
+	age := New(func() int {
+		return 10
+	})
+	var tooFew struct {
+		Name string
+	}
+	requirePanicsWithError(t, "promise returns 2 values, but struct { Name string } has 1 exported fields", func() {
+		AllStruct(&tooFew, name, age)
+	})
+	var wrongType struct {
+		Name string
+		Age  float64
+	}
+	requirePanicsWithError(t, "for field Age: expected type int got type float64", func() {
+		AllStruct(&wrongType, name, age)
+	})
+	requirePanicsWithError(t, "expected pointer to struct, got int", func() {
+		AllStruct(1, name, age)
+	})
+}
+
+func TestMerge(t *testing.T) {
+	name := New(func() string {
+		return "gopher"
+	})
+	age := New(func() int {
+		time.Sleep(10 * time.Millisecond)
+		return 10
+	})
+	var dst struct {
+		Name   string
+		Age    int
+		Ignore bool
+	}
+	dst.Ignore = true
+	require.NoError(t, Merge(&dst, map[string]*Promise{"Name": name, "Age": age}).Wait())
+	require.Equal(t, "gopher", dst.Name)
+	require.Equal(t, 10, dst.Age)
+	require.True(t, dst.Ignore)
+
+	failing := New(func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	err := Merge(&dst, map[string]*Promise{"Name": name, "Age": failing}).Wait()
+	require.EqualError(t, err, "error during promise execution: error encountered in promise: failed")
+}
+
+func TestMergeValidates(t *testing.T) {
+	name := New(func() string {
+		return "gopher"
+	})
+	var dst struct {
+		Name   string
+		Age    float64
+		hidden string
+	}
+	requirePanicsWithError(t, "struct { Name string; Age float64; hidden string } has no exported field Nick", func() {
+		Merge(&dst, map[string]*Promise{"Nick": name})
+	})
+	requirePanicsWithError(t, "struct { Name string; Age float64; hidden string } has no exported field hidden", func() {
+		Merge(&dst, map[string]*Promise{"hidden": name})
+	})
+	requirePanicsWithError(t, "for field Age: expected a promise returning float64, got (string)", func() {
+		Merge(&dst, map[string]*Promise{"Age": name})
+	})
+	requirePanicsWithError(t, "promise for field Name is nil", func() {
+		Merge(&dst, map[string]*Promise{"Name": nil})
+	})
+	requirePanicsWithError(t, "expected pointer to struct, got int", func() {
+		Merge(1, map[string]*Promise{"Name": name})
+	})
+}
+
+type panicSentinel struct {
+	code int
+}
+
+func TestPanicErrorRetainsValue(t *testing.T) {
+	p := New(func() {
+		panic(panicSentinel{code: 42})
+	})
+	err := p.Wait()
+	require.EqualError(t, err, "error during promise execution: {code:42}")
+	panicErr, ok := pkgerrors.Cause(err).(*PanicError)
+	require.True(t, ok, "expected a *PanicError, got %T", pkgerrors.Cause(err))
+	require.Equal(t, panicSentinel{code: 42}, panicErr.Value())
+}
+
+func TestPanicWithErrorPassesThrough(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	p := New(func() {
+		panic(sentinel)
+	})
+	err := p.Wait()
+	require.Equal(t, sentinel, pkgerrors.Cause(err))
+}
+
+func addInts(x, y int) int {
+	return x + y
+}
+
+func BenchmarkNew(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result int
+		err := New(addInts, i, 1).Wait(&result)
+		require.Nil(b, err)
+	}
+}
+
+func BenchmarkPreparedCall(b *testing.B) {
+	b.ReportAllocs()
+	add := Prepare(addInts)
+	for i := 0; i < b.N; i++ {
+		var result int
+		err := add.Call(i, 1).Wait(&result)
+		require.Nil(b, err)
+	}
+}
+
+func TestPrepared(t *testing.T) {
+	add := Prepare(addInts)
+	for i := 0; i < 3; i++ {
+		var result int
+		err := add.Call(i, 1).Wait(&result)
+		require.NoError(t, err)
+		require.Equal(t, i+1, result)
+	}
+	requirePanicsWithError(t, "for argument 1: expected type int got type string", func() {
+		add.Call(1, "one")
+	})
+	requirePanicsWithError(t, "expected 2 args, got 1 args", func() {
+		add.Call(1)
+	})
+	requirePanicsWithError(t, "expected Function, got int", func() {
+		Prepare(1)
+	})
+}
+
+func BenchmarkThen(b *testing.B) {
+	b.ReportAllocs()
+	p := New(func() (int, int) {
+		return 1, 2
+	})
+	for i := 0; i < b.N; i++ {
+		var result int
+		err := p.Then(addInts).Wait(&result)
+		require.Nil(b, err)
+	}
+}
+
+func TestThenResultTypes(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	next := p.Then(func(x int) (int, string, error) {
+		return x, "one", nil
+	})
+	require.Equal(t, []reflect.Type{reflect.TypeOf(0), reflect.TypeOf("")}, next.ResultTypes())
+	require.True(t, next.ReturnsError())
+
+	void := p.Then(func(x int) {})
+	require.Empty(t, void.ResultTypes())
+	require.False(t, void.ReturnsError())
+
+	var x int
+	var s string
+	require.NoError(t, next.Wait(&x, &s))
+	require.Equal(t, 1, x)
+	require.Equal(t, "one", s)
+}
+
+func TestVoidPromises(t *testing.T) {
+	void := func() {}
+	voidErr := func() error {
+		return nil
+	}
+
+	require.NoError(t, New(void).Wait())
+	require.NoError(t, New(void).Then(void).Then(voidErr).Wait())
+	require.NoError(t, All(New(void), New(voidErr), Delay(time.Millisecond)).Wait())
+	require.NoError(t, Race(New(void), New(voidErr), Delay(time.Millisecond)).Wait())
+	require.NoError(t, Any(New(void), New(voidErr), Delay(time.Millisecond)).Wait())
+	require.NoError(t, All().Wait())
+	require.NoError(t, Race().Wait())
+	require.NoError(t, Any().Wait())
+}
+
+func TestVoidPromiseFailures(t *testing.T) {
+	fail := func() error {
+		return errors.New("failed")
+	}
+	require.Error(t, New(fail).Wait())
+	require.Error(t, New(func() {}).Then(fail).Wait())
+	require.Error(t, All(New(func() {}), New(fail)).Wait())
+	require.Error(t, Any(New(fail), New(fail)).Wait())
+}
+
+func TestThenOrSuccess(t *testing.T) {
+	p := New(func() int {
+		return 2
+	}).ThenOr(func(x int) string {
+		return fmt.Sprint(x * 2)
+	}, func() string {
+		return "default"
+	})
+	var result string
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, "4", result)
+}
+
+func TestThenOrFallback(t *testing.T) {
+	p := New(func() (int, error) {
+		return 0, errors.New("failed")
+	}).ThenOr(func(x int) string {
+		return fmt.Sprint(x * 2)
+	}, func() string {
+		return "default"
+	})
+	var result string
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, "default", result)
+}
+
+func TestThenOrValidatesFallback(t *testing.T) {
+	p := New(func() int {
+		return 2
+	})
+	double := func(x int) int {
+		return x * 2
+	}
+	requirePanicsWithError(t, "function returns (int), but fallback returns (string)", func() {
+		p.ThenOr(double, func() string {
+			return ""
+		})
+	})
+	requirePanicsWithError(t, "fallback must not accept arguments, got 1 args", func() {
+		p.ThenOr(double, func(x int) int {
+			return x
+		})
+	})
+}
+
+func TestPromiseAnySuccessFollowedByFailures(t *testing.T) {
+	blocker := make(chan struct{})
+	failLater := func() (string, error) {
+		<-blocker
+		return "", errors.New("failed")
+	}
+	result := Any(New(func() string {
+		return "success"
+	}), New(failLater), New(failLater))
+
+	var retval string
+	require.NoError(t, result.Wait(&retval))
+	close(blocker)
+	// Give the late failures a chance to settle the promise again
+	time.Sleep(10 * time.Millisecond)
+
+	require.NoError(t, result.Wait(&retval))
+	require.Equal(t, "success", retval)
+}
+
+func TestAnyErrIsAndAs(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	pathErr := &os.PathError{Op: "open", Path: "missing", Err: sentinel}
+	err := &AnyErr{Errs: []error{io.EOF, pkgerrors.Wrap(pathErr, "loading")}, LastErr: pathErr}
+
+	// Called directly, as errors.Is and errors.As do before Go 1.20
+	require.True(t, err.Is(sentinel))
+	require.True(t, err.Is(io.EOF))
+	require.False(t, err.Is(io.ErrUnexpectedEOF))
+	var target *os.PathError
+	require.True(t, err.As(&target))
+	require.Equal(t, pathErr, target)
+	var unmatched *net.OpError
+	require.False(t, err.As(&unmatched))
+
+	require.True(t, errors.Is(pkgerrors.Wrap(err, "any"), sentinel))
+}
+
+func TestPromiseAnyAllFailReturnsAnyErr(t *testing.T) {
+	fail := func(msg string) (string, error) {
+		return "", errors.New(msg)
+	}
+	err := Any(New(fail, "first"), New(fail, "second")).Wait(new(string))
+	require.Error(t, err)
+	anyErr, ok := pkgerrors.Cause(err).(*AnyErr)
+	require.True(t, ok, "expected an *AnyErr, got %T", pkgerrors.Cause(err))
+	require.Len(t, anyErr.Errs, 2)
+	require.Contains(t, err.Error(), "all 2 promises failed")
+}
+
+func TestPromiseAnyManyFailuresRecordsEveryError(t *testing.T) {
+	// Run with -race: the failures are recorded concurrently
+	fail := func(i int) (int, error) {
+		return 0, fmt.Errorf("failure %d", i)
+	}
+	for round := 0; round < 20; round++ {
+		promises := make([]*Promise, 16)
+		for i := range promises {
+			promises[i] = New(fail, i)
+		}
+		err := Any(promises...).Wait(new(int))
+		anyErr, ok := pkgerrors.Cause(err).(*AnyErr)
+		require.True(t, ok, "expected an *AnyErr, got %T", pkgerrors.Cause(err))
+		require.Len(t, anyErr.Errs, len(promises))
+		for i, err := range anyErr.Errs {
+			require.EqualError(t, err, fmt.Sprintf("failure %d", i))
+		}
+	}
+}
+
+func TestPromiseSome(t *testing.T) {
+	after := func(d time.Duration, x int) (int, error) {
+		time.Sleep(d)
+		if x < 0 {
+			return 0, errors.New("failed")
+		}
+		return x, nil
+	}
+	tests := []struct {
+		name    string
+		n       int
+		want    []int
+		wantErr bool
+	}{
+		{name: "one", n: 1, want: []int{1}},
+		{name: "two", n: 2, want: []int{1, 3}},
+		{name: "all that can succeed", n: 3, want: []int{1, 3, 4}},
+		{name: "impossible", n: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Some(tt.n,
+				New(after, 30*time.Millisecond, 3),
+				New(after, 0*time.Millisecond, 1),
+				New(after, 10*time.Millisecond, -1),
+				New(after, 50*time.Millisecond, 4),
+			)
+			var values []int
+			err := result.Wait(&values)
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "too many promises failed")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, values)
+		})
+	}
+}
+
+func TestPromiseSomeAllSucceed(t *testing.T) {
+	identity := func(x int) int {
+		return x
+	}
+	var values []int
+	err := Some(3, New(identity, 1), New(identity, 1), New(identity, 1)).Wait(&values)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 1, 1}, values)
+}
+
+func TestPromiseSomeValidatesN(t *testing.T) {
+	p := New(func() {})
+	requirePanicsWithError(t, "Some requires between 0 and 1 successes, got 2", func() {
+		Some(2, p)
+	})
+	require.NoError(t, Some(0, p).Wait())
+}
+
+func TestEmptyResultsIntoSlice(t *testing.T) {
+	values := []int{1, 2}
+	err := All().Wait(&values)
+	require.NoError(t, err)
+	require.NotNil(t, values)
+	require.Empty(t, values)
+
+	strs := []string{"stale"}
+	err = All(New(func() {}), New(func() {})).Wait(&strs)
+	require.NoError(t, err)
+	require.Equal(t, []string{}, strs)
+}
+
+func TestAllThenSliceParameter(t *testing.T) {
+	identity := func(x int) int {
+		return x
+	}
+	sum := All(New(identity, 1), New(identity, 2), New(identity, 3)).Then(func(xs []int) int {
+		total := 0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	})
+	var result int
+	require.NoError(t, sum.Wait(&result))
+	require.Equal(t, 6, result)
+
+	var count int
+	require.NoError(t, All().Then(func(xs []int) int {
+		return len(xs)
+	}).Wait(&count))
+	require.Equal(t, 0, count)
+}
+
+func TestThenSliceResultPassedAsIs(t *testing.T) {
+	p := New(func() []int {
+		return []int{1, 2}
+	}).Then(func(xs []int) int {
+		return len(xs)
+	})
+	var count int
+	require.NoError(t, p.Wait(&count))
+	require.Equal(t, 2, count)
+}
+
+func TestThenSliceParameterHeterogeneous(t *testing.T) {
+	mixed := All(New(func() int {
+		return 1
+	}), New(func() string {
+		return "two"
+	}))
+	requirePanicsWithError(t, "promise returns (int, string), which cannot be absorbed by slice parameter of type []int: result 1 has type string", func() {
+		mixed.Then(func(xs []int) {})
+	})
+}
+
+func TestPromiseID(t *testing.T) {
+	first := New(func() {})
+	second := first.Then(func() {})
+	require.NotZero(t, first.ID())
+	require.True(t, second.ID() > first.ID())
+}
+
+func TestCatch(t *testing.T) {
+	recovered := New(func() (int, error) {
+		return 0, errors.New("failed")
+	}).Catch(func(err error) int {
+		require.EqualError(t, pkgerrors.Cause(err), "failed")
+		return 2
+	})
+	var result int
+	require.NoError(t, recovered.Wait(&result))
+	require.Equal(t, 2, result)
+
+	passed := New(func() int {
+		return 1
+	}).Catch(func(err error) (int, error) {
+		return 0, err
+	})
+	require.NoError(t, passed.Wait(&result))
+	require.Equal(t, 1, result)
+
+	rethrown := New(func() error {
+		return errors.New("failed")
+	}).Catch(func(err error) error {
+		return errors.New("still failed")
+	})
+	require.EqualError(t, rethrown.Wait(), "error during promise execution: still failed")
+}
+
+func TestCatchValidatesFunction(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	requirePanicsWithError(t, "provided function must accept a single error", func() {
+		p.Catch(func() int { return 0 })
+	})
+	requirePanicsWithError(t, "promise returns (int), but provided function returns (string)", func() {
+		p.Catch(func(error) string { return "" })
+	})
+}
+
+func TestWaitAssignableResult(t *testing.T) {
+	p := New(func() (*bytes.Buffer, int) {
+		return bytes.NewBufferString("data"), 1
+	})
+	var reader io.Reader
+	var value interface{}
+	require.NoError(t, p.Wait(&reader, &value))
+	require.IsType(t, &bytes.Buffer{}, reader)
+	require.Equal(t, 1, value)
+
+	var writer io.WriteCloser
+	requirePanicsWithError(t, "for return value 0: expected pointer to *bytes.Buffer got type *io.WriteCloser", func() {
+		p.Wait(&writer, &value)
+	})
+	var buffer bytes.Buffer
+	requirePanicsWithError(t, "for return value 0: expected pointer to *bytes.Buffer got type *bytes.Buffer", func() {
+		p.Wait(&buffer, &value)
+	})
+}
+
+func TestCombinatorsValidateNilPromises(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	combinators := map[string]func(){
+		"All":        func() { All(p, p, nil) },
+		"Race":       func() { Race(p, p, nil) },
+		"Any":        func() { Any(p, p, nil) },
+		"AnyIndexed": func() { AnyIndexed(p, p, nil) },
+		"Some":       func() { Some(1, p, p, nil) },
+		"WaitAll":    func() { WaitAll([]*Promise{p, p, nil}) },
+	}
+	for name, combinator := range combinators {
+		t.Run(name, func(t *testing.T) {
+			requirePanicsWithError(t, "promise at index 2 is nil", combinator)
+		})
+	}
+	requirePanicsWithError(t, "promise at index 0 is nil", func() {
+		Race(nil)
+	})
+}
+
+func TestRaceInterfaceResults(t *testing.T) {
+	readers := func() (slow, fast, declared *Promise) {
+		slow = New(func() *bytes.Buffer {
+			time.Sleep(50 * time.Millisecond)
+			return bytes.NewBufferString("buffer")
+		})
+		fast = New(func() *strings.Reader {
+			return strings.NewReader("reader")
+		})
+		declared = New(func() io.Reader {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		})
+		return
+	}
+	readerType := reflect.TypeOf((*io.Reader)(nil)).Elem()
+
+	slow, fast, declared := readers()
+	p := Race(slow, fast, declared)
+	require.Equal(t, []reflect.Type{readerType}, p.ResultTypes())
+	var reader io.Reader
+	require.NoError(t, p.Wait(&reader))
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "reader", string(data))
+
+	slow, fast, declared = readers()
+	read := Any(declared, slow, fast).Then(func(reader io.Reader) string {
+		data, _ := ioutil.ReadAll(reader)
+		return string(data)
+	})
+	var result string
+	require.NoError(t, read.Wait(&result))
+	require.Equal(t, "reader", result)
+
+	requirePanicsWithError(t, "promise 1 has an unexpected return type, expected all promises passed to Race to return the same type", func() {
+		Race(slow, fast)
+	})
+
+	// RaceAs and AnyAs name the interface when no promise returns it
+	slow, fast, _ = readers()
+	p = RaceAs(readerType, slow, fast)
+	require.Equal(t, []reflect.Type{readerType}, p.ResultTypes())
+	reader = nil
+	require.NoError(t, p.Wait(&reader))
+	data, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "reader", string(data))
+
+	slow, fast, _ = readers()
+	read = AnyAs(readerType, slow, fast).Then(func(reader io.Reader) string {
+		data, _ := ioutil.ReadAll(reader)
+		return string(data)
+	})
+	require.NoError(t, read.Wait(&result))
+	require.Equal(t, "reader", result)
+
+	requirePanicsWithError(t, "promise 1 returns (int), expected all promises passed to RaceAs to return a single value assignable to io.Reader", func() {
+		RaceAs(readerType, fast, New(func() int { return 1 }))
+	})
+	requirePanicsWithError(t, "AnyAs requires at least one promise", func() {
+		AnyAs(readerType)
+	})
+	requirePanicsWithError(t, "promise 2 has an unexpected return type, expected all promises passed to Some to return the same type", func() {
+		Some(1, fast, fast, New(func() (int, int) { return 1, 2 }))
+	})
+
+	// AnyIndexed converts the results of each promise to the common type
+	slow, fast, declared = readers()
+	var index int
+	require.NoError(t, AnyIndexed(slow, declared, fast).Wait(&index, &reader))
+	require.Equal(t, 2, index)
+	data, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "reader", string(data))
+}
+
+func TestThenPropagatesErrorsOnce(t *testing.T) {
+	sentinel := errors.New("failed")
+	origins := map[string]*Promise{
+		"returned": New(func() (int, error) {
+			return 0, sentinel
+		}),
+		"panicked": New(func() int {
+			panic(sentinel)
+		}),
+	}
+	for name, origin := range origins {
+		chained := origin.Then(func(x int) int {
+			return x + 1
+		}).Tap(func(int) {}).Then(func(x int) int {
+			return x + 1
+		})
+		var result int
+		err := chained.Wait(&result)
+		require.EqualError(t, err, "error during promise execution: failed", name)
+		require.Equal(t, sentinel, pkgerrors.Cause(err), name)
+		require.Equal(t, sentinel, chained.WaitUnwrapped(&result), name)
+	}
+
+	chained := New(func() int {
+		panic("not an error")
+	}).Then(func(x int) int {
+		return x
+	})
+	err := chained.WaitUnwrapped(new(int))
+	require.IsType(t, &PanicError{}, err)
+	require.Equal(t, "not an error", err.(*PanicError).Value())
+}
+
+func TestRuntimeErrorPanics(t *testing.T) {
+	var nilMap *map[string]int
+	p := New(func() int {
+		return (*nilMap)["x"]
+	}).Then(func(x int) int {
+		return x
+	})
+	err := p.Wait(new(int))
+	var runtimeErr *RuntimeError
+	require.True(t, errors.As(err, &runtimeErr), "expected a *RuntimeError, got %T", pkgerrors.Cause(err))
+	require.Contains(t, err.Error(), "nil pointer dereference")
+	require.Contains(t, string(runtimeErr.Stack()), "TestRuntimeErrorPanics")
+	var goRuntimeErr runtime.Error
+	require.True(t, errors.As(err, &goRuntimeErr))
+
+	sentinel := errors.New("intentional")
+	intentional := New(func() {
+		panic(sentinel)
+	}).Wait()
+	require.False(t, errors.As(intentional, &runtimeErr))
+	require.True(t, errors.Is(intentional, sentinel))
+}
+
+func TestZeroResults(t *testing.T) {
+	results := zeroResults([]reflect.Type{reflect.TypeOf(0), reflect.TypeOf(""), reflect.TypeOf([]int(nil))})
+	require.Len(t, results, 3)
+	require.Equal(t, 0, results[0].Interface())
+	require.Equal(t, "", results[1].Interface())
+	require.Nil(t, results[2].Interface())
+	require.Empty(t, zeroResults(nil))
+}
+
+func TestResolvedWithoutFunctionHasZeroResults(t *testing.T) {
+	// As a promise settled without running a function, such as by a timer
+	p := newPromise(simpleCall)
+	p.resultType = []reflect.Type{reflect.TypeOf(0), reflect.TypeOf("")}
+	p.settle(nil, nil)
+	n, s := 1, "stale"
+	require.NoError(t, p.Wait(&n, &s))
+	require.Equal(t, 0, n)
+	require.Equal(t, "", s)
+
+	// Downstream stages receive the zero values too
+	var got string
+	require.NoError(t, p.Then(func(n int, s string) string {
+		return fmt.Sprintf("%d %q", n, s)
+	}).Wait(&got))
+	require.Equal(t, `0 ""`, got)
+	require.NoError(t, p.ThenErr(func(n int, s string, err error) string {
+		return fmt.Sprintf("%d %q %v", n, s, err)
+	}).Wait(&got))
+	require.Equal(t, `0 "" <nil>`, got)
+}
+
+func TestThenOnCombinators(t *testing.T) {
+	one := New(func() int { return 1 })
+	two := New(func() int { return 2 })
+	name := New(func() string { return "name" })
+	failing := New(func() (int, error) { return 0, errors.New("failed") })
+
+	// All resolves with the results of the promises concatenated in order
+	var got string
+	require.NoError(t, All(one, name, two).Then(func(x int, s string, y int) string {
+		return fmt.Sprintf("%d %s %d", x, s, y)
+	}).Wait(&got))
+	require.Equal(t, "1 name 2", got)
+	requirePanicsWithError(t, "promise returns 3 values (int, string, int), but provided function accepts 2 args (int, string)", func() {
+		All(one, name, two).Then(func(int, string) {})
+	})
+
+	// Homogeneous results can be absorbed by a slice or a variadic parameter
+	var sum int
+	require.NoError(t, All(one, two).Then(func(xs []int) int {
+		return xs[0] + xs[1]
+	}).Wait(&sum))
+	require.Equal(t, 3, sum)
+	require.NoError(t, All(one, two).Then(func(xs ...int) int {
+		return len(xs)
+	}).Wait(&sum))
+	require.Equal(t, 2, sum)
+
+	// Race, Any and Some resolve with the result types of a single promise,
+	// or n times those for Some
+	for combinator, p := range map[string]*Promise{
+		"Race": Race(one, two),
+		"Any":  Any(failing, one),
+	} {
+		var x int
+		require.NoError(t, p.Then(func(x int) int {
+			return x * 10
+		}).Wait(&x), combinator)
+		require.Contains(t, []int{10, 20}, x, combinator)
+		requirePanicsWithError(t, "promise returns 1 values (int), but provided function accepts 2 args (int, int)", func() {
+			p.Then(func(int, int) {})
+		})
+	}
+	require.NoError(t, Some(2, one, failing, two).Then(func(x, y int) int {
+		return x + y
+	}).Wait(&sum))
+	require.Equal(t, 3, sum)
+
+	// With an interface in common, the continuation accepts the interface
+	stringer := New(func() fmt.Stringer { return &strings.Builder{} })
+	builder := New(func() *strings.Builder { return &strings.Builder{} })
+	require.NoError(t, Race(builder, stringer).Then(func(s fmt.Stringer) string {
+		return s.String()
+	}).Wait(&got))
+	requirePanicsWithError(t, "for argument 0: expected type fmt.Stringer got type *strings.Builder", func() {
+		Any(builder, stringer).Then(func(*strings.Builder) {})
+	})
+}
+
+func TestFunctionResultsPassThrough(t *testing.T) {
+	var calls int
+	p := New(func() func() (int, error) {
+		return func() (int, error) {
+			calls++
+			return 42, nil
+		}
+	})
+	var thunk func() (int, error)
+	require.NoError(t, p.Wait(&thunk))
+	require.Equal(t, 0, calls, "a returned function must not be invoked")
+	value, err := thunk()
+	require.NoError(t, err)
+	require.Equal(t, 42, value)
+
+	// A continuation evaluates it
+	evaluated := p.Then(func(thunk func() (int, error)) (int, error) {
+		return thunk()
+	})
+	require.NoError(t, evaluated.Wait(&value))
+	require.Equal(t, 42, value)
+	require.Equal(t, 2, calls)
+}
+
+func TestAllIndexed(t *testing.T) {
+	after := func(d time.Duration, value interface{}) *Promise {
+		return New(func() (interface{}, error) {
+			time.Sleep(d)
+			if err, ok := value.(error); ok {
+				return nil, err
+			}
+			return value, nil
+		})
+	}
+	var indexed []IndexedResult
+	require.NoError(t, AllIndexed(
+		after(40*time.Millisecond, "slow"),
+		New(func() (int, string) { return 1, "one" }),
+		after(20*time.Millisecond, 2),
+	).Wait(&indexed))
+	require.Equal(t, []IndexedResult{
+		{Index: 1, Values: []interface{}{1, "one"}},
+		{Index: 2, Values: []interface{}{2}},
+		{Index: 0, Values: []interface{}{"slow"}},
+	}, indexed)
+
+	err := AllIndexed(after(time.Second, 0), after(0, errors.New("failed"))).Wait(&indexed)
+	require.EqualError(t, err, "error during promise execution: error in promise 1: failed")
+
+	require.NoError(t, AllIndexed().Wait(&indexed))
+	require.Empty(t, indexed)
+}
+
+func TestNilFunction(t *testing.T) {
+	var uninitialized func() int
+	requirePanicsWithError(t, "New: function argument is nil", func() {
+		New(nil)
+	})
+	requirePanicsWithError(t, "New: function argument is nil", func() {
+		New(uninitialized)
+	})
+
+	p := New(func() int {
+		return 1
+	})
+	var continuation func(int)
+	requirePanicsWithError(t, "Then: function argument is nil", func() {
+		p.Then(nil)
+	})
+	requirePanicsWithError(t, "Then: function argument is nil", func() {
+		p.Then(continuation)
+	})
+	requirePanicsWithError(t, "ThenRetry: function argument is nil", func() {
+		p.ThenRetry(2, continuation)
+	})
+	requirePanicsWithError(t, "ThenThrottled: function argument is nil", func() {
+		p.ThenThrottled(time.Millisecond, continuation)
+	})
+
+	// Every entry point that takes a function reports a nil one by name
+	var fallback func() int
+	slices := New(func() []int { return []int{1} })
+	continuations := map[string]func(f interface{}){
+		"Tap":       func(f interface{}) { p.Tap(f) },
+		"ThenErr":   func(f interface{}) { p.ThenErr(f) },
+		"ThenOr":    func(f interface{}) { p.ThenOr(f, func() {}) },
+		"Catch":     func(f interface{}) { p.Catch(f) },
+		"ThenWith":  func(f interface{}) { p.ThenWith(f) },
+		"ThenSlice": func(f interface{}) { p.ThenSlice(f) },
+		"Spread":    func(f interface{}) { slices.Spread(f) },
+		"ForEach":   func(f interface{}) { slices.ForEach(f) },
+		"ThenMap":   func(f interface{}) { slices.ThenMap(f) },
+		"Reduce":    func(f interface{}) { Reduce([]*Promise{p}, 0, f) },
+		"Prepare":   func(f interface{}) { Prepare(f) },
+		"NewLazy":   func(f interface{}) { NewLazy(f) },
+		"NewWithContext": func(f interface{}) {
+			NewWithContext(context.Background(), f)
+		},
+		"Schedule": func(f interface{}) { Schedule(time.Now(), f) },
+		"NewWithProgress": func(f interface{}) {
+			NewWithProgress(f)
+		},
+		"RetryContext": func(f interface{}) {
+			RetryContext(context.Background(), 1, time.Second, f)
+		},
+		"Compile: stage 1": func(f interface{}) { Compile(func() int { return 1 }, f) },
+	}
+	for caller, call := range continuations {
+		requirePanicsWithError(t, caller+": function argument is nil", func() {
+			call(nil)
+		})
+		requirePanicsWithError(t, caller+": function argument is nil", func() {
+			call(continuation)
+		})
+	}
+	requirePanicsWithError(t, "ThenOr: function argument is nil", func() {
+		p.ThenOr(func(int) int { return 1 }, fallback)
+	})
+}
+
+func TestAllTolerant(t *testing.T) {
+	ok := func(x int) *Promise {
+		return New(func() int {
+			return x
+		})
+	}
+	fail := func(msg string) *Promise {
+		return New(func() (int, error) {
+			return 0, errors.New(msg)
+		})
+	}
+
+	// Below and at the threshold
+	for _, maxFailures := range []int{2, 1} {
+		var settled []Settled
+		require.NoError(t, AllTolerant(maxFailures, ok(1), fail("down"), ok(3)).Wait(&settled))
+		require.Len(t, settled, 3)
+		require.Equal(t, Settled{Index: 0, Values: []interface{}{1}}, settled[0])
+		require.Equal(t, 1, settled[1].Index)
+		require.Nil(t, settled[1].Values)
+		require.EqualError(t, settled[1].Err, "error during promise execution: down")
+		require.Equal(t, Settled{Index: 2, Values: []interface{}{3}}, settled[2])
+	}
+
+	// Above the threshold, without waiting for the others
+	blocker := make(chan struct{})
+	defer close(blocker)
+	pending := New(func() int {
+		<-blocker
+		return 0
+	})
+	err := AllTolerant(1, pending, fail("first"), New(func() (int, error) {
+		time.Sleep(10 * time.Millisecond)
+		return 0, errors.New("second")
+	})).Wait(new([]Settled))
+	require.EqualError(t, err, "error during promise execution: too many promises failed, 2 failures exceed the limit of 1: second")
+
+	// With no tolerance it fails like All
+	require.Error(t, AllTolerant(0, ok(1), fail("down")).Wait(new([]Settled)))
+	requirePanicsWithError(t, "AllTolerant requires a non-negative number of failures, got -1", func() {
+		AllTolerant(-1)
+	})
+}
+
+func TestThenSlice(t *testing.T) {
+	square := func(x int) int {
+		return x * x
+	}
+	all := All(New(square, 1), New(square, 2), New(square, 3))
+	sum := all.ThenSlice(func(squares []int) int {
+		total := 0
+		for _, x := range squares {
+			total += x
+		}
+		return total
+	})
+	var result int
+	require.NoError(t, sum.Wait(&result))
+	require.Equal(t, 14, result)
+
+	// A single slice result is wrapped too, unlike with Then
+	nested := New(func() []int {
+		return []int{1, 2}
+	}).ThenSlice(func(slices [][]int) int {
+		return len(slices)
+	})
+	require.NoError(t, nested.Wait(&result))
+	require.Equal(t, 1, result)
+
+	requirePanicsWithError(t, "provided function must accept a single slice, got func(int) int", func() {
+		all.ThenSlice(square)
+	})
+	requirePanicsWithError(t, "promise returns (int, int, int), which cannot be absorbed by slice parameter of type []string: result 0 has type int", func() {
+		all.ThenSlice(func([]string) {})
+	})
+}
+
+func TestNewValue(t *testing.T) {
+	intType := reflect.TypeOf(0)
+	double := reflect.MakeFunc(reflect.FuncOf([]reflect.Type{intType}, []reflect.Type{intType}, false), func(args []reflect.Value) []reflect.Value {
+		return []reflect.Value{reflect.ValueOf(int(args[0].Int() * 2))}
+	})
+	var result int
+	require.NoError(t, NewValue(double, reflect.ValueOf(21)).Wait(&result))
+	require.Equal(t, 42, result)
+
+	// Arguments only need to be assignable
+	var reader io.Reader
+	require.NoError(t, NewValue(reflect.ValueOf(func(r io.Reader) io.Reader {
+		return r
+	}), reflect.ValueOf(strings.NewReader("data"))).Wait(&reader))
+	require.NotNil(t, reader)
+
+	requirePanicsWithError(t, "expected Function, got int", func() {
+		NewValue(reflect.ValueOf(1))
+	})
+	requirePanicsWithError(t, "expected 1 args, got 0 args", func() {
+		NewValue(double)
+	})
+	requirePanicsWithError(t, "for argument 0: expected type int got type string", func() {
+		NewValue(double, reflect.ValueOf("21"))
+	})
+	requirePanicsWithError(t, "for argument 0: expected type int got invalid Value", func() {
+		NewValue(double, reflect.Value{})
+	})
+}
+
+func TestThenWith(t *testing.T) {
+	p := New(func() int {
+		time.Sleep(20 * time.Millisecond)
+		return 1
+	}).WithName("slow")
+	next := p.ThenWith(func(prior *Promise) (string, time.Duration, error) {
+		var result int
+		if err := prior.Wait(&result); err != nil {
+			return "", 0, err
+		}
+		return fmt.Sprintf("%s=%d", prior.Name(), result), prior.Duration(), nil
+	})
+	var summary string
+	var duration time.Duration
+	require.NoError(t, next.Wait(&summary, &duration))
+	require.Equal(t, "slow=1", summary)
+	require.True(t, duration >= 20*time.Millisecond)
+
+	// f is called for failed promises too
+	recovered := New(func() error {
+		return errors.New("failed")
+	}).ThenWith(func(prior *Promise) bool {
+		return prior.Wait() != nil
+	})
+	var failed bool
+	require.NoError(t, recovered.Wait(&failed))
+	require.True(t, failed)
+
+	requirePanicsWithError(t, "provided function must accept a single *promise.Promise", func() {
+		p.ThenWith(func(int) {})
+	})
+}
+
+func TestRaceSinglePromiseIsIndependent(t *testing.T) {
+	blocker := make(chan struct{})
+	input := New(func() int {
+		<-blocker
+		return 1
+	})
+	raced := Race(input)
+	require.False(t, raced == input)
+	raced.WithName("raced")
+	require.Equal(t, "", input.Name())
+
+	// Cancelling the race leaves its input running
+	require.True(t, raced.Cancel())
+	close(blocker)
+	var result int
+	require.NoError(t, input.Wait(&result))
+	require.Equal(t, 1, result)
+	require.Equal(t, ErrCancelled, pkgerrors.Cause(raced.Wait(&result)))
+
+	raced = Race(input)
+	require.NoError(t, raced.Wait(&result))
+	require.Equal(t, 1, result)
+
+	failing := New(func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	err := Any(failing).Wait(&result)
+	var anyErr *AnyErr
+	require.True(t, errors.As(err, &anyErr))
+	require.EqualError(t, anyErr.LastErr, "failed")
+}
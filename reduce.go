@@ -0,0 +1,117 @@
+package promise
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Reduce returns a promise that folds the results of the promises into a
+// single value, calling reducer with the accumulated value and the results of
+// each promise in input order, starting from initial. reducer must accept an
+// A followed by the result types of the promises, which must all be the same
+// as for Race, and return an A, optionally followed by an error. initial must
+// be assignable to A; nil stands for the zero A. The returned promise
+// resolves with the final A.
+//
+// Reduce fails fast: it fails as soon as any promise fails, or reducer
+// returns an error, without waiting for the remaining promises.
+func Reduce(promises []*Promise, initial interface{}, reducer interface{}) *Promise {
+	return reduce(promises, initial, reducer, false)
+}
+
+// ReduceCompleted is like Reduce, but calls reducer with the results of the
+// promises in the order in which they complete, so that the fold does not
+// wait on a slow promise at the front.
+//
+// Unlike All, which holds the results of every promise until all of them
+// complete, ReduceCompleted releases each promise once its results are
+// folded. If the caller drops its references to the promises as well, their
+// results can be garbage collected while the others are still running, which
+// keeps memory bounded for many promises with large results.
+func ReduceCompleted(promises []*Promise, initial interface{}, reducer interface{}) *Promise {
+	return reduce(promises, initial, reducer, true)
+}
+
+func reduce(promises []*Promise, initial interface{}, reducer interface{}, completionOrder bool) *Promise {
+	checkPromises(promises)
+	caller := "Reduce"
+	if completionOrder {
+		caller = "ReduceCompleted"
+	}
+	reducerRv := reflect.ValueOf(reducer)
+	checkFunction(caller, reducerRv)
+	reducerType := reducerRv.Type()
+	var resultType []reflect.Type
+	if len(promises) > 0 {
+		resultType = sameResultType(caller, promises)
+	}
+	if reducerType.NumIn() == 0 {
+		panic(errors.New("reducer must accept an accumulator"))
+	}
+	accType := reducerType.In(0)
+	values := make([]reflect.Type, reducerType.NumIn()-1)
+	for i := range values {
+		values[i] = reducerType.In(i + 1)
+	}
+	if len(promises) > 0 && !reflect.DeepEqual(values, resultType) {
+		panic(errors.Errorf("promises return %s, but reducer accepts %s after the accumulator", typeList(resultType), typeList(values)))
+	}
+	outputs, returnsError := getResultType(reducerType)
+	if len(outputs) != 1 || outputs[0] != accType {
+		panic(errors.Errorf("reducer must return its accumulator type %s, got %s", accType, typeList(outputs)))
+	}
+	accRv := reflect.New(accType).Elem()
+	if initial != nil {
+		initialRv := reflect.ValueOf(initial)
+		if !initialRv.Type().AssignableTo(accType) {
+			panic(errors.Errorf("initial value of type %s is not assignable to accumulator type %s", initialRv.Type(), accType))
+		}
+		accRv.Set(initialRv)
+	}
+
+	// Promises are released as soon as their results are folded, so that
+	// their results can be collected before the others complete
+	pending := append([]*Promise(nil), promises...)
+	fold := reflect.MakeFunc(reflect.FuncOf(nil, []reflect.Type{accType}, false), func([]reflect.Value) []reflect.Value {
+		acc := accRv
+		apply := func(results []reflect.Value) {
+			out := reducerRv.Call(append([]reflect.Value{acc}, results...))
+			if returnsError && !isNilError(out[1]) {
+				panic(out[1].Interface().(error))
+			}
+			acc = out[0]
+		}
+
+		done := make(chan int, len(pending))
+		for i, p := range pending {
+			i := i
+			p.OnComplete(func(error) {
+				done <- i
+			})
+		}
+		completed := make([]bool, len(pending))
+		next := 0
+		for range pending {
+			i := <-done
+			results, err := pending[i].outcome()
+			if err != nil {
+				panic(wrapError(err, pending[i].label(fmt.Sprintf("error in promise %d", i))))
+			}
+			if completionOrder {
+				apply(results)
+				pending[i] = nil
+				continue
+			}
+			completed[i] = true
+			for next < len(pending) && completed[next] {
+				apply(pending[next].results)
+				pending[next] = nil
+				next++
+			}
+		}
+		return []reflect.Value{acc}
+	})
+	return New(fold.Interface())
+}
@@ -0,0 +1,144 @@
+package promise
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReduceSums(t *testing.T) {
+	promises := make([]*Promise, 10)
+	for i := range promises {
+		promises[i] = New(func(x int) int {
+			return x
+		}, i+1)
+	}
+	var sum int
+	require.NoError(t, Reduce(promises, 0, func(acc, x int) int {
+		return acc + x
+	}).Wait(&sum))
+	require.Equal(t, 55, sum)
+
+	require.NoError(t, ReduceCompleted(promises, 5, func(acc, x int) int {
+		return acc + x
+	}).Wait(&sum))
+	require.Equal(t, 60, sum)
+
+	require.NoError(t, Reduce(nil, 3, func(acc int) int {
+		return acc
+	}).Wait(&sum))
+	require.Equal(t, 3, sum)
+}
+
+func TestReduceOrder(t *testing.T) {
+	letters := func() []*Promise {
+		return []*Promise{
+			New(func() string {
+				time.Sleep(30 * time.Millisecond)
+				return "a"
+			}),
+			New(func() string {
+				return "b"
+			}),
+		}
+	}
+	concat := func(acc []string, s string) []string {
+		return append(acc, s)
+	}
+	var result []string
+	require.NoError(t, Reduce(letters(), nil, concat).Wait(&result))
+	require.Equal(t, []string{"a", "b"}, result)
+	require.NoError(t, ReduceCompleted(letters(), nil, concat).Wait(&result))
+	require.Equal(t, []string{"b", "a"}, result)
+}
+
+func TestReduceFailsFast(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	promises := []*Promise{
+		New(func() int {
+			<-blocker
+			return 1
+		}),
+		New(func() (int, error) {
+			return 0, errors.New("failed")
+		}),
+	}
+	err := Reduce(promises, 0, func(acc, x int) int {
+		return acc + x
+	}).Wait(new(int))
+	require.EqualError(t, err, "error during promise execution: error in promise 1: failed")
+
+	err = Reduce(promises[1:], 0, func(acc, x int) (int, error) {
+		return 0, errors.New("unreachable")
+	}).Wait(new(int))
+	require.Error(t, err)
+
+	err = Reduce([]*Promise{New(func() int { return 1 })}, 0, func(acc, x int) (int, error) {
+		return 0, errors.New("reducer failed")
+	}).Wait(new(int))
+	require.EqualError(t, err, "error during promise execution: reducer failed")
+}
+
+func TestReduceValidates(t *testing.T) {
+	promises := []*Promise{New(func() int { return 1 })}
+	requirePanicsWithError(t, "promises return (int), but reducer accepts (string) after the accumulator", func() {
+		Reduce(promises, 0, func(acc int, s string) int { return acc })
+	})
+	requirePanicsWithError(t, "reducer must return its accumulator type int, got (string)", func() {
+		Reduce(promises, 0, func(acc, x int) string { return "" })
+	})
+	requirePanicsWithError(t, "initial value of type string is not assignable to accumulator type int", func() {
+		Reduce(promises, "0", func(acc, x int) int { return acc })
+	})
+}
+
+// benchmarkRetained reports the heap retained by the promise created by
+// combine over promises returning large payloads, once it has completed.
+func benchmarkRetained(b *testing.B, combine func(promises []*Promise) *Promise, out func() interface{}) {
+	const payload = 64 << 10
+	b.ReportAllocs()
+	var retained uint64
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		promises := make([]*Promise, 256)
+		for j := range promises {
+			promises[j] = New(func() []byte {
+				return make([]byte, payload)
+			})
+		}
+		p := combine(promises)
+		promises = nil
+		require.NoError(b, p.Wait(out()))
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		if after.HeapAlloc > before.HeapAlloc {
+			retained += after.HeapAlloc - before.HeapAlloc
+		}
+		runtime.KeepAlive(p)
+	}
+	b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+}
+
+func BenchmarkAllLargeResults(b *testing.B) {
+	benchmarkRetained(b, func(promises []*Promise) *Promise {
+		return All(promises...)
+	}, func() interface{} {
+		return new([][]byte)
+	})
+}
+
+func BenchmarkReduceCompletedLargeResults(b *testing.B) {
+	benchmarkRetained(b, func(promises []*Promise) *Promise {
+		return ReduceCompleted(promises, 0, func(n int, payload []byte) int {
+			return n + 1
+		})
+	}, func() interface{} {
+		return new(int)
+	})
+}
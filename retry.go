@@ -0,0 +1,134 @@
+package promise
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ThenRetry is like Then, but calls f again with the same results of this
+// Promise, up to attempts times in total, while it panics or returns a
+// non-nil error. The attempts follow each other immediately. If every attempt
+// fails, the returned promise fails like Then with the failure of the last
+// attempt. This Promise is not run again; only f is retried.
+func (p *Promise) ThenRetry(attempts int, f interface{}) *Promise {
+	if attempts < 1 {
+		panic(errors.Errorf("ThenRetry requires at least 1 attempt, got %d", attempts))
+	}
+	functionRv := reflect.ValueOf(f)
+	checkFunction("ThenRetry", functionRv)
+	_, returnsError := getResultType(functionRv.Type())
+	retrying := reflect.MakeFunc(functionRv.Type(), func(args []reflect.Value) []reflect.Value {
+		for attempt := 1; ; attempt++ {
+			if attempt == attempts {
+				return callFunction(functionRv, args)
+			}
+			if results, ok := tryCall(functionRv, args, returnsError); ok {
+				return results
+			}
+		}
+	})
+	next, retryingRv := p.then(retrying.Interface())
+	next.start(retryingRv, p, nil, 0, nil)
+	return next
+}
+
+// tryCall calls functionRv with args and reports whether it returned without
+// panicking or returning a non-nil trailing error.
+func tryCall(functionRv reflect.Value, args []reflect.Value, returnsError bool) (results []reflect.Value, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+	results = callFunction(functionRv, args)
+	return results, !returnsError || isNilError(results[len(results)-1])
+}
+
+// callFunction calls functionRv with args, passing the variadic arguments of
+// a variadic function as the slice they arrive in.
+func callFunction(functionRv reflect.Value, args []reflect.Value) []reflect.Value {
+	if functionRv.Type().IsVariadic() {
+		return functionRv.CallSlice(args)
+	}
+	return functionRv.Call(args)
+}
+
+// RetryContext returns a promise that calls f with args, like New, up to
+// attempts times in total until a call succeeds, and resolves with the results
+// of that call. Each attempt fails with ErrTimeout if it does not complete
+// within perAttempt, which counts as a failure to retry; the timed out call
+// keeps running. If every attempt fails, the promise fails with the error of
+// the last one.
+//
+// The promise fails with ctx.Err() as soon as ctx is done, and no further
+// attempts are made. If the first parameter of f is a context.Context, each
+// call receives a context derived from ctx that is done once its attempt
+// times out, as with NewWithContext.
+func RetryContext(ctx context.Context, attempts int, perAttempt time.Duration, f interface{}, args ...interface{}) *Promise {
+	if attempts < 1 {
+		panic(errors.Errorf("RetryContext requires at least 1 attempt, got %d", attempts))
+	}
+	pr := prepare("RetryContext", reflect.ValueOf(f))
+	takesContext := len(pr.inputs) > 0 && pr.inputs[0] == contextType
+	bound := pr
+	if takesContext {
+		bound.inputs = pr.inputs[1:]
+	}
+	p, argValues := bound.bind(ctx, args)
+
+	attempt := func() *Promise {
+		attemptCtx, cancel := context.WithTimeout(ctx, perAttempt)
+		next := pr.promise(ctx)
+		attemptArgs := argValues
+		if takesContext {
+			attemptArgs = append([]reflect.Value{reflect.ValueOf(&attemptCtx).Elem()}, argValues...)
+		}
+		next.start(pr.functionRv, nil, nil, 0, attemptArgs)
+		next.onComplete(func(error) {
+			cancel()
+		})
+		return next.Timeout(perAttempt)
+	}
+	// Each attempt is started once the one before it fails, rather than by a
+	// goroutine waiting on it, so that attempts go through the Executor like
+	// any other promise and a SyncExecutor can drive them
+	var attemptAt func(i int)
+	attemptAt = func(i int) {
+		next := attempt()
+		next.onComplete(func(err error) {
+			if err == nil {
+				results, _ := next.outcome()
+				p.settle(results, nil)
+				return
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = ctxErr
+			} else if i+1 < attempts && !p.isComplete() {
+				attemptAt(i + 1)
+				return
+			}
+			p.settle(nil, err)
+		})
+	}
+	if err := ctx.Err(); err != nil {
+		p.settle(nil, err)
+		return p
+	}
+	attemptAt(0)
+	if ctx.Done() != nil {
+		// The watcher only waits for ctx and calls no function, so it does not
+		// go through the Executor: a SyncExecutor would block in Step until
+		// ctx is done
+		go func() {
+			select {
+			case <-ctx.Done():
+				p.settle(nil, ctx.Err())
+			case <-p.doneChan():
+			}
+		}()
+	}
+	return p
+}
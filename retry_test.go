@@ -0,0 +1,113 @@
+package promise
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThenRetry(t *testing.T) {
+	var priorCalls, calls int32
+	prior := New(func() int {
+		atomic.AddInt32(&priorCalls, 1)
+		return 20
+	})
+	p := prior.ThenRetry(3, func(x int) (int, error) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			return 0, errors.New("flaky")
+		case 2:
+			panic("flakier")
+		}
+		return x + 1, nil
+	})
+	var result int
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, 21, result)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	require.Equal(t, int32(1), atomic.LoadInt32(&priorCalls))
+}
+
+func TestThenRetryGivesUp(t *testing.T) {
+	var calls int32
+	p := New(func() int {
+		return 1
+	}).ThenRetry(2, func(x int) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("always")
+	})
+	require.EqualError(t, p.Wait(), "error during promise execution: always")
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	variadic := New(func() (int, int) {
+		return 1, 2
+	}).ThenRetry(1, func(xs ...int) int {
+		return len(xs)
+	})
+	var n int
+	require.NoError(t, variadic.Wait(&n))
+	require.Equal(t, 2, n)
+
+	requirePanicsWithError(t, "ThenRetry requires at least 1 attempt, got 0", func() {
+		New(func() {}).ThenRetry(0, func() {})
+	})
+}
+
+func TestRetryContextRetriesTimedOutAttempts(t *testing.T) {
+	var calls int32
+	p := RetryContext(context.Background(), 3, 20*time.Millisecond, func(ctx context.Context, x int) (int, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			// Too slow, the attempt times out
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return x, nil
+	}, 7)
+	var result int
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, 7, result)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestRetryContextGivesUp(t *testing.T) {
+	var calls int32
+	p := RetryContext(context.Background(), 2, time.Second, func() error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("unavailable")
+	})
+	require.EqualError(t, p.Wait(), "error during promise execution: unavailable")
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	blocker := make(chan struct{})
+	defer close(blocker)
+	slow := RetryContext(context.Background(), 2, 10*time.Millisecond, func() {
+		<-blocker
+	})
+	require.Equal(t, ErrTimeout, pkgerrors.Cause(slow.Wait()))
+}
+
+func TestRetryContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+	p := RetryContext(ctx, 100, 10*time.Millisecond, func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			cancel()
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.Equal(t, context.Canceled, pkgerrors.Cause(p.Wait()))
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	requirePanicsWithError(t, "RetryContext requires at least 1 attempt, got 0", func() {
+		RetryContext(context.Background(), 0, time.Second, func() {})
+	})
+	requirePanicsWithError(t, "expected 1 args, got 0 args", func() {
+		RetryContext(context.Background(), 1, time.Second, func(context.Context, int) {})
+	})
+}
@@ -0,0 +1,52 @@
+package promise
+
+// State is the state of a promise, see Promise.State.
+type State int
+
+const (
+	// Pending is the state of a promise that has not settled yet
+	Pending State = iota
+	// Resolved is the state of a promise that succeeded
+	Resolved
+	// Rejected is the state of a promise that failed, because its function
+	// panicked or returned an error or a promise it depends on failed
+	Rejected
+	// Cancelled is the state of a promise settled by Cancel
+	Cancelled
+)
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Resolved:
+		return "resolved"
+	case Rejected:
+		return "rejected"
+	case Cancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// State returns the current state of the promise without blocking. Promises
+// chained from a cancelled promise fail with ErrCancelled, but are Rejected
+// rather than Cancelled, as Cancel was not called on them.
+func (p *Promise) State() State {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	return p.state()
+}
+
+// state returns the state of the promise, with its lock held.
+func (p *Promise) state() State {
+	switch {
+	case !p.complete:
+		return Pending
+	case p.cancelled:
+		return Cancelled
+	case p.err != nil:
+		return Rejected
+	}
+	return Resolved
+}
@@ -0,0 +1,51 @@
+package promise
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestState(t *testing.T) {
+	blocker := make(chan struct{})
+	resolved := New(func() int {
+		<-blocker
+		return 1
+	})
+	require.Equal(t, Pending, resolved.State())
+	close(blocker)
+	require.NoError(t, resolved.Wait(new(int)))
+	require.Equal(t, Resolved, resolved.State())
+
+	rejected := New(func() error {
+		return errors.New("failed")
+	})
+	require.Error(t, rejected.Wait())
+	require.Equal(t, Rejected, rejected.State())
+
+	panicked := New(func() {
+		panic("boom")
+	})
+	require.Error(t, panicked.Wait())
+	require.Equal(t, Rejected, panicked.State())
+
+	pending := make(chan struct{})
+	defer close(pending)
+	cancelled := New(func() {
+		<-pending
+	})
+	chained := cancelled.Then(func() {})
+	require.True(t, cancelled.Cancel())
+	require.Equal(t, Cancelled, cancelled.State())
+	require.Error(t, chained.Wait())
+	require.Equal(t, Rejected, chained.State())
+}
+
+func TestStateString(t *testing.T) {
+	require.Equal(t, "pending", Pending.String())
+	require.Equal(t, "resolved", Resolved.String())
+	require.Equal(t, "rejected", Rejected.String())
+	require.Equal(t, "cancelled", Cancelled.String())
+	require.Equal(t, "unknown", State(-1).String())
+}
@@ -0,0 +1,50 @@
+package promise
+
+// A Stream is an asynchronously executing unit of work that produces a
+// sequence of values over time, rather than a single result like a Promise.
+type Stream struct {
+	values chan interface{}
+	done   *Promise
+}
+
+// NewStream starts f in the background and returns a Stream of the values it
+// passes to emit. emit blocks until the value is received by the consumer of
+// the stream and must not be called after f returns. Any panic() encountered
+// in f ends the stream and is returned as an error from Err().
+func NewStream(f func(emit func(interface{}))) *Stream {
+	s := &Stream{
+		values: make(chan interface{}),
+	}
+	s.done = New(func() {
+		defer close(s.values)
+		f(func(value interface{}) {
+			s.values <- value
+		})
+	})
+	return s
+}
+
+// Values returns the channel of emitted values, which is closed once the
+// function of the stream returns. A stream has a single consumer: either
+// receive from Values or call Collect, not both.
+func (s *Stream) Values() <-chan interface{} {
+	return s.values
+}
+
+// Err blocks until the function of the stream returns, and returns the
+// error if it panicked.
+func (s *Stream) Err() error {
+	return s.done.Wait()
+}
+
+// Collect returns a promise that consumes the stream and resolves with a
+// []interface{} of all emitted values, or fails if the stream fails.
+func (s *Stream) Collect() *Promise {
+	return New(func() ([]interface{}, error) {
+		values := []interface{}{}
+		for value := range s.values {
+			values = append(values, value)
+		}
+		return values, s.Err()
+	})
+}
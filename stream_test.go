@@ -0,0 +1,44 @@
+package promise
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamValues(t *testing.T) {
+	s := NewStream(func(emit func(interface{})) {
+		for i := 0; i < 3; i++ {
+			emit(i)
+		}
+	})
+	values := []interface{}{}
+	for value := range s.Values() {
+		values = append(values, value)
+	}
+	require.NoError(t, s.Err())
+	require.Equal(t, []interface{}{0, 1, 2}, values)
+}
+
+func TestStreamCollect(t *testing.T) {
+	s := NewStream(func(emit func(interface{})) {
+		emit("a")
+		emit("b")
+	})
+	var values []interface{}
+	err := s.Collect().Wait(&values)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"a", "b"}, values)
+}
+
+func TestStreamPanic(t *testing.T) {
+	s := NewStream(func(emit func(interface{})) {
+		emit(1)
+		panic("stream failed")
+	})
+	var values []interface{}
+	err := s.Collect().Wait(&values)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "stream failed")
+	require.Error(t, s.Err())
+}
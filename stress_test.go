@@ -0,0 +1,51 @@
+package promise
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestLongChainSingleProc checks that no wakeup is missed when every waiter
+// of a long chain shares a single processor.
+func TestLongChainSingleProc(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	const n = 10000
+	increment := func(x int) int {
+		return x + 1
+	}
+
+	// Chained up front, every continuation parks before its prior completes
+	p := New(func() int {
+		return 0
+	})
+	for i := 0; i < n; i++ {
+		p = p.Then(increment)
+	}
+	var result int
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, n, result)
+
+	// Chained from inside running promises
+	done := make(chan *Promise, 1)
+	var extend func(depth int) func(x int) int
+	extend = func(depth int) func(x int) int {
+		return func(x int) int {
+			if depth == n {
+				return x
+			}
+			next := New(func() int {
+				return x + 1
+			})
+			if depth == n-1 {
+				done <- next
+			}
+			next.Then(extend(depth + 1))
+			return x
+		}
+	}
+	New(extend(0), 0)
+	require.NoError(t, (<-done).Wait(&result))
+	require.Equal(t, n, result)
+}
@@ -0,0 +1,12 @@
+// Package copylock dereferences and copies a Promise, which go vet must report.
+package copylock
+
+import (
+	promise "github.com/garlicnation/promises/v2"
+)
+
+func copyPromise() {
+	p := promise.New(func() {})
+	copied := *p
+	_ = copied.Wait()
+}
@@ -0,0 +1,69 @@
+package promise
+
+import (
+	"context"
+	"sync"
+)
+
+// A Tracker keeps track of outstanding promises so that they can be drained,
+// for instance on server shutdown. It is like a sync.WaitGroup for promises.
+// The zero value is ready to use and is safe for concurrent use.
+type Tracker struct {
+	mu      sync.Mutex
+	pending int
+	// idle is closed once pending drops to zero
+	idle chan struct{}
+}
+
+// New calls New(f, args...) and tracks the returned promise.
+func (t *Tracker) New(f interface{}, args ...interface{}) *Promise {
+	return t.Track(New(f, args...))
+}
+
+// Track adds p to the tracked promises until it settles, and returns p.
+// Tracking a promise created by NewLazy starts it.
+func (t *Tracker) Track(p *Promise) *Promise {
+	t.mu.Lock()
+	if t.pending == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.pending++
+	t.mu.Unlock()
+
+	p.onComplete(func(error) {
+		t.mu.Lock()
+		t.pending--
+		if t.pending == 0 {
+			close(t.idle)
+		}
+		t.mu.Unlock()
+	})
+	return p
+}
+
+// Pending returns the number of tracked promises that have not settled yet.
+func (t *Tracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pending
+}
+
+// Wait blocks until all tracked promises have settled, or returns ctx.Err()
+// if ctx is done first. Promises tracked while Wait is blocked are waited for
+// as well.
+func (t *Tracker) Wait(ctx context.Context) error {
+	t.mu.Lock()
+	if t.pending == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
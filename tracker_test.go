@@ -0,0 +1,47 @@
+package promise
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackerDrains(t *testing.T) {
+	var tracker Tracker
+	require.NoError(t, tracker.Wait(context.Background()), "an empty tracker is drained")
+
+	blocker := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		tracker.New(func() {
+			<-blocker
+		})
+	}
+	tracker.Track(New(func() error {
+		<-blocker
+		panic("failed")
+	}))
+	require.Equal(t, 4, tracker.Pending())
+
+	time.AfterFunc(10*time.Millisecond, func() {
+		close(blocker)
+	})
+	require.NoError(t, tracker.Wait(context.Background()))
+	require.Equal(t, 0, tracker.Pending())
+}
+
+func TestTrackerDrainTimeout(t *testing.T) {
+	var tracker Tracker
+	blocker := make(chan struct{})
+	defer close(blocker)
+	tracker.New(func() {
+		<-blocker
+	})
+	tracker.New(func() {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, tracker.Wait(ctx))
+	require.Equal(t, 1, tracker.Pending())
+}
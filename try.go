@@ -0,0 +1,73 @@
+package promise
+
+import "reflect"
+
+// ValidationError is returned by the Try variants of New, Then and Wait when
+// the provided function or arguments do not match what the promise expects,
+// in cases where the plain variants panic.
+type ValidationError struct {
+	Err error
+}
+
+func (err *ValidationError) Error() string {
+	return err.Err.Error()
+}
+
+// Cause returns the underlying validation failure.
+func (err *ValidationError) Cause() error {
+	return err.Err
+}
+
+// Unwrap returns the underlying validation failure, so that errors.Is and
+// errors.As match it.
+func (err *ValidationError) Unwrap() error {
+	return err.Err
+}
+
+// validate runs f, returning a validation panic raised by it as a
+// *ValidationError.
+func validate(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			cause, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			err = &ValidationError{Err: cause}
+		}
+	}()
+	f()
+	return nil
+}
+
+// TryNew is like New, but returns a *ValidationError instead of panicking if
+// f is not a function or args do not match its parameters.
+func TryNew(f interface{}, args ...interface{}) (p *Promise, err error) {
+	err = validate(func() {
+		p = New(f, args...)
+	})
+	return p, err
+}
+
+// TryThen is like Then, but returns a *ValidationError instead of panicking
+// if f cannot accept the results of the promise.
+func (p *Promise) TryThen(f interface{}) (next *Promise, err error) {
+	err = validate(func() {
+		next = p.Then(f)
+	})
+	return next, err
+}
+
+// TryWait is like Wait, but returns a *ValidationError instead of panicking
+// if out does not match the results of the promise. It does not block in
+// that case.
+func (p *Promise) TryWait(out ...interface{}) error {
+	var bind func(results []reflect.Value)
+	if err := validate(func() {
+		bind = p.binder(out)
+	}); err != nil {
+		return err
+	}
+	p.outcome()
+	return p.bindResults(bind)
+}
@@ -0,0 +1,72 @@
+package promise
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryNew(t *testing.T) {
+	p, err := TryNew(func(a int) int {
+		return a * 2
+	}, 2)
+	require.NoError(t, err)
+	var result int
+	require.NoError(t, p.Wait(&result))
+	require.Equal(t, 4, result)
+
+	_, err = TryNew(func(a int) {}, "2")
+	require.IsType(t, &ValidationError{}, err)
+	require.EqualError(t, err, "for argument 0: expected type int got type string")
+
+	_, err = TryNew(func(a int) {})
+	require.EqualError(t, err, "expected 1 args, got 0 args")
+
+	_, err = TryNew(5)
+	require.EqualError(t, err, "expected Function, got int")
+}
+
+func TestTryThen(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	_, err := p.TryThen(func(s string) {})
+	require.IsType(t, &ValidationError{}, err)
+	require.EqualError(t, err, "for argument 0: expected type int got type string")
+
+	next, err := p.TryThen(func(a int) int {
+		return a + 1
+	})
+	require.NoError(t, err)
+	var result int
+	require.NoError(t, next.Wait(&result))
+	require.Equal(t, 2, result)
+}
+
+func TestTryWait(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	p := New(func() int {
+		<-blocker
+		return 1
+	})
+	var s string
+	// Validation fails without waiting for the promise
+	err := p.TryWait(&s)
+	require.IsType(t, &ValidationError{}, err)
+	require.EqualError(t, err, "for return value 0: expected pointer to int got type *string")
+}
+
+func TestValidationErrorUnwraps(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	err := validate(func() {
+		panic(sentinel)
+	})
+	require.IsType(t, &ValidationError{}, err)
+	require.Equal(t, sentinel, errors.Unwrap(err))
+	require.True(t, errors.Is(err, sentinel))
+	var validationErr *ValidationError
+	require.True(t, errors.As(fmt.Errorf("wrapped: %w", err), &validationErr))
+}
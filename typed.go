@@ -0,0 +1,80 @@
+package promise
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Typed is a promise that resolves with a single value of type R, created by
+// New0 to New3. Unlike New, these check the types of f and its arguments at
+// compile time. Use New for functions with more arguments.
+//
+// For instance, given
+//
+//	parse := func(s string, base int) (int64, error) {
+//		return strconv.ParseInt(s, base, 64)
+//	}
+//
+// none of the following compile, where New and Wait would panic at run time:
+//
+//	New2(parse, 16, "ff")                 // arguments swapped
+//	New2(parse, "ff")                     // argument missing
+//	New1(parse, "ff")                     // parse takes two arguments
+//	var n int
+//	n, err = New2(parse, "ff", 16).Wait() // Wait returns an int64
+type Typed[R any] struct {
+	p *Promise
+}
+
+// Promise returns the underlying promise, for chaining and combinators.
+func (t *Typed[R]) Promise() *Promise {
+	return t.p
+}
+
+// Wait blocks until the promise completes and returns its value, or the
+// error Wait of Promise would return.
+func (t *Typed[R]) Wait() (R, error) {
+	var result R
+	err := t.p.Wait(&result)
+	return result, err
+}
+
+// New0 returns a promise that resolves with the value returned by f.
+func New0[R any](f func() (R, error)) *Typed[R] {
+	return &Typed[R]{New(f)}
+}
+
+// New1 returns a promise that resolves with the value returned by f called
+// with a.
+func New1[A, R any](f func(A) (R, error), a A) *Typed[R] {
+	return &Typed[R]{New(func() (R, error) {
+		return f(a)
+	})}
+}
+
+// New2 returns a promise that resolves with the value returned by f called
+// with a and b.
+func New2[A, B, R any](f func(A, B) (R, error), a A, b B) *Typed[R] {
+	return &Typed[R]{New(func() (R, error) {
+		return f(a, b)
+	})}
+}
+
+// New3 returns a promise that resolves with the value returned by f called
+// with a, b and c.
+func New3[A, B, C, R any](f func(A, B, C) (R, error), a A, b B, c C) *Typed[R] {
+	return &Typed[R]{New(func() (R, error) {
+		return f(a, b, c)
+	})}
+}
+
+// Await blocks until p completes and returns its single result as a T, or the
+// error Wait would return. It panics if p does not return exactly one value
+// assignable to T.
+func Await[T any](p *Promise) (T, error) {
+	var result T
+	if len(p.resultType) != 1 {
+		panic(errors.Errorf("Await requires a promise that returns a single value, got %s", typeList(p.resultType)))
+	}
+	err := p.Wait(&result)
+	return result, err
+}
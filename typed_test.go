@@ -0,0 +1,111 @@
+package promise
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTyped(t *testing.T) {
+	value, err := New0(func() (int, error) {
+		return 1, nil
+	}).Wait()
+	require.NoError(t, err)
+	require.Equal(t, 1, value)
+
+	// Arguments are checked at compile time, so an interface parameter
+	// accepts a nil or concrete argument, unlike with New
+	length, err := New1(func(r io.Reader) (int, error) {
+		if r == nil {
+			return 0, nil
+		}
+		data, err := io.ReadAll(r)
+		return len(data), err
+	}, nil).Wait()
+	require.NoError(t, err)
+	require.Equal(t, 0, length)
+
+	_, err = New1(strconv.ParseBool, "maybe").Wait()
+	require.Error(t, err)
+
+	joined, err := New3(func(a, b string, n int) (string, error) {
+		return strings.Repeat(a+b, n), nil
+	}, "a", "b", 2).Wait()
+	require.NoError(t, err)
+	require.Equal(t, "abab", joined)
+
+	failing := New1(func(string) (int, error) {
+		return 0, errors.New("failed")
+	}, "x")
+	_, err = failing.Wait()
+	require.EqualError(t, err, "error during promise execution: failed")
+
+	chained := failing.Promise().ThenErr(func(_ int, err error) string {
+		return err.Error()
+	})
+	var message string
+	require.NoError(t, chained.Wait(&message))
+	require.Equal(t, "failed", message)
+}
+
+func ExampleNew2() {
+	// Passing "10" for the int would not compile, where New would panic
+	p := New2(func(s string, base int) (int64, error) {
+		return strconv.ParseInt(s, base, 64)
+	}, "ff", 16)
+	value, err := p.Wait()
+	fmt.Println(value, err)
+	// Output: 255 <nil>
+}
+
+func ExampleNew1() {
+	parse := func(s string) (int, error) {
+		return strconv.Atoi(s)
+	}
+	// New1(parse, 42) would not compile: cannot use 42 (untyped int
+	// constant) as string value in argument to New1
+	value, err := New1(parse, "42").Wait()
+	fmt.Println(value, err)
+
+	// New only finds the same mistake at run time
+	defer func() {
+		fmt.Println(recover())
+	}()
+	New(parse, 42)
+	// Output:
+	// 42 <nil>
+	// for argument 0: expected type string got type int
+}
+
+func TestAwait(t *testing.T) {
+	p := New(func() (string, error) {
+		return "one", nil
+	})
+	value, err := Await[string](p)
+	require.NoError(t, err)
+	require.Equal(t, "one", value)
+
+	// A result is assignable to an interface it implements
+	stringer, err := Await[fmt.Stringer](New(func() *strings.Builder {
+		return &strings.Builder{}
+	}))
+	require.NoError(t, err)
+	require.NotNil(t, stringer)
+
+	_, err = Await[int](New(func() (int, error) {
+		return 0, errors.New("failed")
+	}))
+	require.EqualError(t, err, "error during promise execution: failed")
+
+	requirePanicsWithError(t, "for return value 0: expected pointer to string got type *int", func() {
+		Await[int](p)
+	})
+	requirePanicsWithError(t, "Await requires a promise that returns a single value, got (int, int)", func() {
+		Await[[]int](New(func() (int, int) { return 1, 2 }))
+	})
+}
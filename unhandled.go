@@ -0,0 +1,58 @@
+package promise
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+type unhandledHolder struct {
+	handler func(p *Promise, err error)
+}
+
+var unhandled atomic.Value
+
+func init() {
+	unhandled.Store(unhandledHolder{})
+}
+
+// SetUnhandledHandler sets a hook that is called with a promise that failed
+// and its error if the promise is garbage collected without its outcome ever
+// being observed, to surface errors that would otherwise be lost. The outcome
+// of a promise is observed by waiting on it in any way, by OnComplete or Chan,
+// and by chaining or combining it with other promises, which take over its
+// error. Promises that fail because they were cancelled are not reported.
+// Passing nil removes the hook.
+//
+// Failed promises are detected with a finalizer, so the hook is called from
+// the finalizer goroutine, only after a garbage collection, and possibly not
+// at all, for instance if the program exits first. Only promises that fail
+// while the hook is set are tracked.
+func SetUnhandledHandler(handler func(p *Promise, err error)) {
+	unhandled.Store(unhandledHolder{handler})
+}
+
+// observe marks the outcome of the promise as handled, and starts it if it
+// is lazy.
+func (p *Promise) observe() {
+	atomic.StoreInt32(&p.handled, 1)
+	p.demand()
+}
+
+// reportUnhandled arranges for the unhandled handler, if any, to be called
+// with the error of the failed promise if it is collected unobserved.
+func (p *Promise) reportUnhandled() {
+	if p.err == ErrCancelled || atomic.LoadInt32(&p.handled) != 0 {
+		return
+	}
+	if unhandled.Load().(unhandledHolder).handler == nil {
+		return
+	}
+	runtime.SetFinalizer(p, func(p *Promise) {
+		if atomic.LoadInt32(&p.handled) != 0 {
+			return
+		}
+		if handler := unhandled.Load().(unhandledHolder).handler; handler != nil {
+			handler(p, p.err)
+		}
+	})
+}
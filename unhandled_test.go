@@ -0,0 +1,56 @@
+package promise
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetUnhandledHandler(t *testing.T) {
+	// The handler runs on the finalizer goroutine, so it only reports the
+	// error and the test goroutine asserts on it
+	reported := make(chan error, 1)
+	var waited int32
+	SetUnhandledHandler(func(p *Promise, err error) {
+		switch p.Name() {
+		case "unhandled":
+			select {
+			case reported <- err:
+			default:
+			}
+		case "waited":
+			atomic.AddInt32(&waited, 1)
+		}
+	})
+	defer SetUnhandledHandler(nil)
+
+	func() {
+		New(func() error {
+			time.Sleep(10 * time.Millisecond)
+			return errors.New("lost")
+		}).WithName("unhandled")
+		p := New(func() error {
+			time.Sleep(10 * time.Millisecond)
+			return errors.New("seen")
+		}).WithName("waited")
+		require.Error(t, p.Wait())
+	}()
+
+	var err error
+	requireEventually(t, func() bool {
+		runtime.GC()
+		select {
+		case err = <-reported:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+	require.EqualError(t, err, "lost")
+	runtime.GC()
+	require.Equal(t, int32(0), atomic.LoadInt32(&waited))
+}
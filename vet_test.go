@@ -0,0 +1,21 @@
+package promise
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVetReportsPromiseCopies(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go vet in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	out, err := exec.Command(goTool, "vet", "./testdata/copylock").CombinedOutput()
+	require.Error(t, err, "go vet should fail on a copied Promise")
+	require.Contains(t, string(out), "copies lock value")
+}
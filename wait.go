@@ -0,0 +1,380 @@
+package promise
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrTimeout is returned by WaitTimeout if the promise does not complete in time.
+var ErrTimeout = errors.New("timed out waiting for promise")
+
+// outcome blocks until the promise completes and returns its results and error.
+func (p *Promise) outcome() ([]reflect.Value, error) {
+	p.observe()
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	if !p.complete {
+		defer p.watch()()
+	}
+	for !p.complete {
+		p.cond.Wait()
+	}
+	return p.results, p.err
+}
+
+// wait blocks until the promise completes or ctx is done, in which case it
+// returns ctx.Err().
+func (p *Promise) wait(ctx context.Context) error {
+	if ctx.Done() == nil {
+		p.outcome()
+		return nil
+	}
+	p.observe()
+	done := p.doneChan()
+	select {
+	case <-done:
+		return nil
+	default:
+	}
+	defer p.watch()()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// doneChan returns a channel that is closed once the promise settles. Unlike
+// a callback registered with OnComplete, waiting on it leaves nothing behind
+// when the wait is abandoned.
+func (p *Promise) doneChan() <-chan struct{} {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	if p.done == nil {
+		p.done = make(chan struct{})
+		if p.complete {
+			close(p.done)
+		}
+	}
+	return p.done
+}
+
+// WaitContext is like Wait, but returns ctx.Err() if ctx is done before the
+// promise completes. The promise keeps running in that case.
+func (p *Promise) WaitContext(ctx context.Context, out ...interface{}) error {
+	bind := p.binder(out)
+	if err := p.wait(ctx); err != nil {
+		return err
+	}
+	return p.bindResults(bind)
+}
+
+// WaitTimeout is like Wait, but returns ErrTimeout if the promise does not
+// complete within d. The promise keeps running in that case.
+func (p *Promise) WaitTimeout(d time.Duration, out ...interface{}) error {
+	bind := p.binder(out)
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	// Release the timer as soon as the promise completes in time
+	defer cancel()
+	if err := p.wait(ctx); err != nil {
+		return ErrTimeout
+	}
+	return p.bindResults(bind)
+}
+
+// WaitCtxTimeout combines WaitContext and WaitTimeout: it returns ctx.Err() if
+// ctx is done, or ErrTimeout if d elapses, before the promise completes. The
+// promise keeps running in either case.
+func (p *Promise) WaitCtxTimeout(ctx context.Context, d time.Duration, out ...interface{}) error {
+	bind := p.binder(out)
+	timeoutCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	if err := p.wait(timeoutCtx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrTimeout
+	}
+	return p.bindResults(bind)
+}
+
+// WaitOrDefault is like Wait, but swallows the error of the promise: it
+// reports whether the promise succeeded, and if it failed, sets each out
+// argument to the zero value of its type instead of returning the error. It
+// is meant for optional data, where a failure is not worth handling; use
+// Wait whenever the error matters.
+func (p *Promise) WaitOrDefault(out ...interface{}) bool {
+	bind := p.binder(out)
+	if _, err := p.outcome(); err != nil {
+		for _, o := range out {
+			outRv := reflect.ValueOf(o).Elem()
+			outRv.Set(reflect.Zero(outRv.Type()))
+		}
+		return false
+	}
+	bind(p.results)
+	return true
+}
+
+// WaitUnwrapped is like Wait, but returns the error of the promise as is
+// rather than wrapped with a message, so that it can be compared directly to a
+// sentinel error. The error returned by Wait wraps the same error and works
+// with errors.Is and errors.As as well.
+func (p *Promise) WaitUnwrapped(out ...interface{}) error {
+	bind := p.binder(out)
+	if _, err := p.outcome(); err != nil {
+		return err
+	}
+	return p.bindResults(bind)
+}
+
+// WaitCopy is like Wait, but binds a copy of each result that is a slice or a
+// map, so that the caller may modify it without affecting other callers
+// waiting on the same promise. Only the top level is copied: the elements of
+// the copies, and the values behind pointers, are still shared.
+func (p *Promise) WaitCopy(out ...interface{}) error {
+	bind := p.binder(out)
+	p.outcome()
+	return p.bindResults(func(results []reflect.Value) {
+		copies := make([]reflect.Value, len(results))
+		for i, result := range results {
+			copies[i] = shallowCopy(result)
+		}
+		bind(copies)
+	})
+}
+
+// shallowCopy returns a copy of v if it is a non-nil slice or map, and v
+// itself otherwise.
+func shallowCopy(v reflect.Value) reflect.Value {
+	switch {
+	case v.Kind() == reflect.Slice && !v.IsNil():
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		return c
+	case v.Kind() == reflect.Map && !v.IsNil():
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), iter.Value())
+		}
+		return c
+	}
+	return v
+}
+
+// WaitRaw is like Wait, but binds the trailing error of the function of the
+// promise positionally, like an ordinary result, instead of returning it. out
+// must hold a pointer for each result followed by an *error, which is set to
+// the error the function returned, as is. The results the function returned
+// alongside a non-nil error are bound as well.
+//
+// Wait, in contrast, strips the trailing error: a non-nil error fails the
+// promise, and Wait returns it wrapped without binding any results. WaitRaw
+// still returns an error if the function did not return, for example because
+// it panicked, the promise was cancelled or a promise it depends on failed.
+func (p *Promise) WaitRaw(out ...interface{}) error {
+	if !p.returnsError {
+		panic(errors.New("WaitRaw requires a function returning a trailing error, use Wait instead"))
+	}
+	if len(out) != len(p.resultType)+1 {
+		panic(errors.Errorf("Promise returns %d values and an error, WaitRaw was asked to set %d values", len(p.resultType), len(out)))
+	}
+	errOut, ok := out[len(out)-1].(*error)
+	if !ok || errOut == nil {
+		panic(errors.Errorf("for the trailing error: expected *error got type %T", out[len(out)-1]))
+	}
+	bind := p.binder(out[:len(out)-1])
+	p.outcome()
+	if p.err != nil && p.results == nil {
+		// The function did not return
+		return p.waitError()
+	}
+	bind(p.results)
+	*errOut = p.err
+	return nil
+}
+
+// WaitInto blocks until the promise completes and assigns its results to the
+// exported fields of the struct pointed to by dst, in declaration order. Like
+// with Wait, each result must be assignable to its field, such as a concrete
+// type to an interface it implements. It returns a *ValidationError without
+// blocking if the number or types of the exported fields do not match the
+// results of the promise.
+func (p *Promise) WaitInto(dst interface{}) error {
+	var bind func(results []reflect.Value)
+	if err := validate(func() {
+		bind = structBinder(p.resultType, dst)
+	}); err != nil {
+		return err
+	}
+	p.outcome()
+	return p.bindResults(bind)
+}
+
+// WaitIndex blocks until the promise completes and binds only its result at
+// index i to out, which must be a pointer to a type the result is assignable
+// to. It returns a *ValidationError without blocking if i is out of range or
+// out does not match.
+func (p *Promise) WaitIndex(i int, out interface{}) error {
+	if err := validate(func() {
+		if i < 0 || i >= len(p.resultType) {
+			panic(errors.Errorf("result index %d out of range, promise returns %d values", i, len(p.resultType)))
+		}
+		outType := outPointer(i, out).Type()
+		if outType.Kind() != reflect.Ptr || !p.resultType[i].AssignableTo(outType.Elem()) {
+			panic(errors.Errorf("for return value %d: expected pointer to %s got type %s", i, p.resultType[i], outType))
+		}
+	}); err != nil {
+		return err
+	}
+	p.outcome()
+	return p.bindResults(func(results []reflect.Value) {
+		reflect.ValueOf(out).Elem().Set(results[i])
+	})
+}
+
+// WaitMap blocks until the promise completes and sets out[names[i]] to its
+// result at index i. It returns a *ValidationError without blocking if the
+// number of names does not match the results of the promise, a name is
+// repeated or out is nil.
+func (p *Promise) WaitMap(names []string, out map[string]interface{}) error {
+	if err := validate(func() {
+		if len(names) != len(p.resultType) {
+			panic(errors.Errorf("Promise returns %d values, WaitMap was given %d names", len(p.resultType), len(names)))
+		}
+		if out == nil {
+			panic(errors.New("WaitMap requires a non-nil map"))
+		}
+		seen := make(map[string]bool, len(names))
+		for _, name := range names {
+			if seen[name] {
+				panic(errors.Errorf("name %q is repeated", name))
+			}
+			seen[name] = true
+		}
+	}); err != nil {
+		return err
+	}
+	p.outcome()
+	return p.bindResults(func(results []reflect.Value) {
+		for i, name := range names {
+			out[name] = results[i].Interface()
+		}
+	})
+}
+
+// structBinder validates that dst is a pointer to a struct whose exported
+// fields, in declaration order, can be assigned the values of resultType, and
+// returns a function that assigns results to those fields.
+func structBinder(resultType []reflect.Type, dst interface{}) func(results []reflect.Value) {
+	dstRv := reflect.ValueOf(dst)
+	if !dstRv.IsValid() || dstRv.Kind() != reflect.Ptr || dstRv.Elem().Kind() != reflect.Struct {
+		panic(errors.Errorf("expected pointer to struct, got %T", dst))
+	}
+	if dstRv.IsNil() {
+		panic(errors.New("destination struct pointer is nil"))
+	}
+	structRv := dstRv.Elem()
+	fields := []int{}
+	for i := 0; i < structRv.NumField(); i++ {
+		if structRv.Type().Field(i).PkgPath == "" {
+			fields = append(fields, i)
+		}
+	}
+	if len(fields) != len(resultType) {
+		panic(errors.Errorf("promise returns %d values, but %s has %d exported fields", len(resultType), structRv.Type(), len(fields)))
+	}
+	for i, field := range fields {
+		structField := structRv.Type().Field(field)
+		if !resultType[i].AssignableTo(structField.Type) {
+			panic(errors.Errorf("for field %s: expected type %s got type %s", structField.Name, resultType[i], structField.Type))
+		}
+	}
+	return func(results []reflect.Value) {
+		for i, field := range fields {
+			structRv.Field(field).Set(results[i])
+		}
+	}
+}
+
+// interfaces converts results to a slice of interface{} values.
+func interfaces(results []reflect.Value) []interface{} {
+	values := make([]interface{}, len(results))
+	for i, result := range results {
+		values[i] = result.Interface()
+	}
+	return values
+}
+
+// WaitAll waits for all of the passed promises and returns the results of each
+// one, in the order the promises were passed. Unlike All followed by Wait,
+// the promises may return any mix of types.
+//
+// WaitAll fails fast: it returns as soon as any promise fails, with an error
+// naming the index of the failed promise, without waiting for the others to
+// settle.
+func WaitAll(promises []*Promise) ([][]interface{}, error) {
+	checkPromises(promises)
+	done := make(chan int, len(promises))
+	for i, p := range promises {
+		i := i
+		p.OnComplete(func(error) {
+			done <- i
+		})
+	}
+
+	values := make([][]interface{}, len(promises))
+	for range promises {
+		i := <-done
+		results, err := promises[i].outcome()
+		if err != nil {
+			return nil, wrapError(err, promises[i].label(fmt.Sprintf("error in promise %d", i)))
+		}
+		values[i] = interfaces(results)
+	}
+	return values, nil
+}
+
+// WaitFirstN waits until n of the passed promises succeed and returns the
+// indices of those promises and their results, in completion order, leaving
+// the others running. Like WaitAll, the promises may return any mix of types.
+//
+// WaitFirstN fails as soon as so many promises have failed that n successes
+// are impossible, with the error of the last one to fail.
+func WaitFirstN(n int, promises []*Promise) ([]int, [][]interface{}, error) {
+	checkPromises(promises)
+	if n < 0 || n > len(promises) {
+		panic(errors.Errorf("WaitFirstN requires between 0 and %d successes, got %d", len(promises), n))
+	}
+	done := make(chan int, len(promises))
+	for i, p := range promises {
+		i := i
+		p.OnComplete(func(error) {
+			done <- i
+		})
+	}
+
+	indices := make([]int, 0, n)
+	values := make([][]interface{}, 0, n)
+	failures := 0
+	for len(indices) < n {
+		i := <-done
+		results, err := promises[i].outcome()
+		if err != nil {
+			failures++
+			if failures > len(promises)-n {
+				return nil, nil, wrapError(err, promises[i].label(fmt.Sprintf("too many promises failed, last was promise %d", i)))
+			}
+			continue
+		}
+		indices = append(indices, i)
+		values = append(values, interfaces(results))
+	}
+	return indices, values, nil
+}
@@ -0,0 +1,490 @@
+package promise
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitAll(t *testing.T) {
+	values, err := WaitAll([]*Promise{
+		New(func() int {
+			time.Sleep(10 * time.Millisecond)
+			return 1
+		}),
+		New(func() (string, bool) {
+			return "two", true
+		}),
+		New(func() {}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, [][]interface{}{{1}, {"two", true}, {}}, values)
+}
+
+func TestWaitAllFailsFast(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	_, err := WaitAll([]*Promise{
+		New(func() {
+			<-blocker
+		}),
+		New(func() error {
+			return errors.New("failed")
+		}),
+	})
+	require.EqualError(t, err, "error in promise 1: failed")
+}
+
+func TestWaitTimeout(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	p := New(func() int {
+		<-blocker
+		return 1
+	})
+	var result int
+	err := p.WaitTimeout(10*time.Millisecond, &result)
+	require.Equal(t, ErrTimeout, err)
+}
+
+func TestWaitTimeoutCompletesInTime(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	var result int
+	err := p.WaitTimeout(time.Second, &result)
+	require.NoError(t, err)
+	require.Equal(t, 1, result)
+
+	failing := New(func() error {
+		return errors.New("failed")
+	})
+	err = failing.WaitTimeout(time.Second)
+	require.EqualError(t, err, "error during promise execution: failed")
+}
+
+func TestWaitContextCancelled(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	p := New(func() {
+		<-blocker
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, p.WaitContext(ctx))
+}
+
+func TestWaitCtxTimeout(t *testing.T) {
+	p := New(func() int {
+		return 1
+	})
+	var result int
+	require.NoError(t, p.WaitCtxTimeout(context.Background(), time.Second, &result))
+	require.Equal(t, 1, result)
+
+	blocker := make(chan struct{})
+	defer close(blocker)
+	blocked := New(func() int {
+		<-blocker
+		return 1
+	})
+	require.Equal(t, ErrTimeout, blocked.WaitCtxTimeout(context.Background(), 10*time.Millisecond, &result))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	require.Equal(t, context.Canceled, blocked.WaitCtxTimeout(ctx, time.Minute, &result))
+
+	// A context deadline is reported as the context's error
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelDeadline()
+	require.Equal(t, context.DeadlineExceeded, blocked.WaitCtxTimeout(deadline, time.Minute, &result))
+}
+
+func TestAbandonedWaitsLeaveNoCallbacks(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	p := New(func() {
+		<-blocker
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 100; i++ {
+		require.Equal(t, ErrTimeout, p.WaitTimeout(time.Microsecond))
+		require.Equal(t, context.Canceled, p.WaitContext(ctx))
+		require.Equal(t, context.Canceled, p.WaitCtxTimeout(ctx, time.Hour))
+	}
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	require.Empty(t, p.callbacks)
+}
+
+func TestWaitInto(t *testing.T) {
+	p := New(func() (string, int, []byte) {
+		return "name", 3, []byte("data")
+	})
+	var dst struct {
+		Name   string
+		Count  int
+		hidden bool
+		Data   []byte
+	}
+	require.NoError(t, p.WaitInto(&dst))
+	require.Equal(t, "name", dst.Name)
+	require.Equal(t, 3, dst.Count)
+	require.Equal(t, []byte("data"), dst.Data)
+
+	var tooFew struct {
+		Name string
+	}
+	err := p.WaitInto(&tooFew)
+	require.IsType(t, &ValidationError{}, err)
+	require.Contains(t, err.Error(), "promise returns 3 values, but")
+
+	var mistyped struct {
+		Name  string
+		Count string
+		Data  []byte
+	}
+	err = p.WaitInto(&mistyped)
+	require.EqualError(t, err, "for field Count: expected type int got type string")
+
+	err = p.WaitInto(dst)
+	require.IsType(t, &ValidationError{}, err)
+
+	// Results are assigned to fields of an interface type they implement
+	var assignable struct {
+		Name  fmt.Stringer
+		Count interface{}
+		Data  []byte
+	}
+	named := New(func() (*bytes.Buffer, int, []byte) {
+		return bytes.NewBufferString("name"), 3, nil
+	})
+	require.NoError(t, named.WaitInto(&assignable))
+	require.Equal(t, "name", assignable.Name.String())
+	require.Equal(t, 3, assignable.Count)
+
+	failing := New(func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	var result struct {
+		Value int
+	}
+	require.EqualError(t, failing.WaitInto(&result), "error during promise execution: failed")
+}
+
+type codeError struct {
+	code int
+}
+
+func (err *codeError) Error() string {
+	return "code error"
+}
+
+func TestWaitUnwrapped(t *testing.T) {
+	p := New(func() (int, error) {
+		return 0, io.EOF
+	})
+	var result int
+	require.Equal(t, io.EOF, p.WaitUnwrapped(&result))
+
+	err := p.Wait(&result)
+	require.EqualError(t, err, "error during promise execution: EOF")
+	require.True(t, errors.Is(err, io.EOF))
+
+	typed := New(func() error {
+		return &codeError{code: 7}
+	})
+	var target *codeError
+	require.True(t, errors.As(typed.Wait(), &target))
+	require.Equal(t, 7, target.code)
+	require.Equal(t, target, typed.WaitUnwrapped())
+
+	succeeding := New(func() int {
+		return 1
+	})
+	require.NoError(t, succeeding.WaitUnwrapped(&result))
+	require.Equal(t, 1, result)
+}
+
+func TestErrorsIsThroughChains(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	failing := New(func() (int, error) {
+		return 0, sentinel
+	})
+	chained := failing.Then(func(x int) int {
+		return x + 1
+	}).Tap(func(int) {}).Then(func(x int) string {
+		return "unreachable"
+	})
+	other := New(func() int {
+		return 1
+	})
+
+	promises := map[string]*Promise{
+		"Then":     chained,
+		"All":      All(other, chained.Then(func(string) int { return 0 })),
+		"Race":     Race(failing, failing.Then(func(x int) int { return x })),
+		"Any":      Any(failing, failing.Then(func(x int) int { return x })),
+		"Some":     Some(2, other, failing),
+		"Timeout":  chained.Timeout(time.Second),
+		"Pipeline": Pipe(failing).Then(func(x int) {}).Build(),
+	}
+	for name, p := range promises {
+		// The error Wait returns, regardless of the result types
+		p.outcome()
+		err := p.waitError()
+		require.True(t, errors.Is(err, sentinel), "%s: %v", name, err)
+	}
+
+	_, err := WaitAll([]*Promise{other, chained})
+	require.True(t, errors.Is(err, sentinel))
+}
+
+func TestContextErrorsDetectableAfterWait(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), 0)
+	defer cancelExpired()
+
+	for _, ctx := range []context.Context{cancelled, expired} {
+		returned := New(func() error {
+			return ctx.Err()
+		})
+		panicked := New(func() int {
+			panic(ctx.Err())
+		})
+		promises := map[string]*Promise{
+			"returned": returned,
+			"panicked": panicked,
+			"Then":     panicked.Then(func(int) {}),
+			"All":      All(New(func() {}), returned),
+			"context":  NewWithContext(ctx, func() {}),
+		}
+		for name, p := range promises {
+			// The error Wait returns, regardless of the result types
+			p.outcome()
+			err := p.waitError()
+			require.True(t, errors.Is(err, ctx.Err()), "%s: %v", name, err)
+		}
+	}
+}
+
+func TestWaitIndex(t *testing.T) {
+	p := New(func() (int, string, error) {
+		return 1, "one", nil
+	})
+	var s string
+	require.NoError(t, p.WaitIndex(1, &s))
+	require.Equal(t, "one", s)
+	var n interface{}
+	require.NoError(t, p.WaitIndex(0, &n))
+	require.Equal(t, 1, n)
+
+	for _, i := range []int{-1, 2} {
+		err := p.WaitIndex(i, &s)
+		require.IsType(t, &ValidationError{}, err)
+		require.EqualError(t, err, fmt.Sprintf("result index %d out of range, promise returns 2 values", i))
+	}
+	require.EqualError(t, p.WaitIndex(0, &s), "for return value 0: expected pointer to int got type *string")
+	require.EqualError(t, p.WaitIndex(0, nil), "out argument 0 is a nil pointer")
+	require.EqualError(t, p.WaitIndex(1, nil), "out argument 1 is a nil pointer")
+
+	failing := New(func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	require.EqualError(t, failing.WaitIndex(0, new(int)), "error during promise execution: failed")
+}
+
+func TestWaitMap(t *testing.T) {
+	p := New(func() (string, int, error) {
+		return "alice", 42, nil
+	})
+	out := map[string]interface{}{}
+	require.NoError(t, p.WaitMap([]string{"name", "age"}, out))
+	require.Equal(t, map[string]interface{}{"name": "alice", "age": 42}, out)
+
+	err := p.WaitMap([]string{"name"}, out)
+	require.IsType(t, &ValidationError{}, err)
+	require.EqualError(t, err, "Promise returns 2 values, WaitMap was given 1 names")
+	require.EqualError(t, p.WaitMap([]string{"name", "name"}, out), `name "name" is repeated`)
+	require.EqualError(t, p.WaitMap([]string{"name", "age"}, nil), "WaitMap requires a non-nil map")
+
+	failing := New(func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	failedOut := map[string]interface{}{}
+	require.EqualError(t, failing.WaitMap([]string{"n"}, failedOut), "error during promise execution: failed")
+	require.Empty(t, failedOut)
+}
+
+func TestWaitCopy(t *testing.T) {
+	p := New(func() ([]int, map[string]int) {
+		return []int{1, 2}, map[string]int{"a": 1}
+	})
+
+	// Wait shares the results between callers
+	var first, second []int
+	var firstMap, secondMap map[string]int
+	require.NoError(t, p.Wait(&first, &firstMap))
+	first[0] = 100
+	firstMap["a"] = 100
+	require.NoError(t, p.Wait(&second, &secondMap))
+	require.Equal(t, []int{100, 2}, second)
+	require.Equal(t, map[string]int{"a": 100}, secondMap)
+
+	// WaitCopy does not
+	var copied []int
+	var copiedMap map[string]int
+	require.NoError(t, p.WaitCopy(&copied, &copiedMap))
+	copied[0] = 200
+	copiedMap["a"] = 200
+	copiedMap["b"] = 2
+	require.NoError(t, p.Wait(&second, &secondMap))
+	require.Equal(t, []int{100, 2}, second)
+	require.Equal(t, map[string]int{"a": 100}, secondMap)
+
+	nilSlice := New(func() []int {
+		return nil
+	})
+	require.NoError(t, nilSlice.WaitCopy(&copied))
+	require.Nil(t, copied)
+}
+
+func TestWaitOrDefault(t *testing.T) {
+	p := New(func() (string, int) {
+		return "name", 1
+	})
+	var s string
+	var n int
+	require.True(t, p.WaitOrDefault(&s, &n))
+	require.Equal(t, "name", s)
+	require.Equal(t, 1, n)
+
+	failing := New(func() (string, int, error) {
+		return "partial", 2, errors.New("failed")
+	})
+	require.False(t, failing.WaitOrDefault(&s, &n))
+	require.Equal(t, "", s)
+	require.Equal(t, 0, n)
+
+	var values []int
+	values = []int{1}
+	require.False(t, New(func() (int, error) {
+		panic("boom")
+	}).WaitOrDefault(&values))
+	require.Nil(t, values)
+}
+
+func TestWaitRaw(t *testing.T) {
+	parse := func(s string) *Promise {
+		return New(func() (int, error) {
+			if s == "" {
+				return -1, io.EOF
+			}
+			return len(s), nil
+		})
+	}
+
+	var n int
+	var err error
+	require.NoError(t, parse("abc").WaitRaw(&n, &err))
+	require.Equal(t, 3, n)
+	require.NoError(t, err)
+
+	// The error is bound as is, along with the results returned with it
+	require.NoError(t, parse("").WaitRaw(&n, &err))
+	require.Equal(t, -1, n)
+	require.Equal(t, io.EOF, err)
+
+	// Wait strips the same error instead
+	require.EqualError(t, parse("").Wait(&n), "error during promise execution: EOF")
+
+	voidErr := New(func() error {
+		return io.EOF
+	})
+	require.NoError(t, voidErr.WaitRaw(&err))
+	require.Equal(t, io.EOF, err)
+}
+
+func TestWaitRawFunctionDidNotReturn(t *testing.T) {
+	p := New(func() (int, error) {
+		panic("boom")
+	})
+	var n int
+	var err error
+	require.EqualError(t, p.WaitRaw(&n, &err), "error during promise execution: boom")
+	require.NoError(t, err)
+}
+
+func TestWaitRawValidates(t *testing.T) {
+	var n int
+	var err error
+	requirePanicsWithError(t, "WaitRaw requires a function returning a trailing error, use Wait instead", func() {
+		New(func() int { return 1 }).WaitRaw(&n, &err)
+	})
+	p := New(func() (int, error) { return 1, nil })
+	requirePanicsWithError(t, "Promise returns 1 values and an error, WaitRaw was asked to set 1 values", func() {
+		p.WaitRaw(&n)
+	})
+	requirePanicsWithError(t, "for the trailing error: expected *error got type *int", func() {
+		p.WaitRaw(&n, &n)
+	})
+}
+
+func TestWaitFirstN(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	indices, values, err := WaitFirstN(2, []*Promise{
+		New(func() int {
+			<-blocker
+			return 0
+		}),
+		New(func() (string, error) {
+			time.Sleep(20 * time.Millisecond)
+			return "slow", nil
+		}),
+		New(func() error {
+			return errors.New("failed")
+		}),
+		New(func() int {
+			return 3
+		}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 1}, indices)
+	require.Equal(t, [][]interface{}{{3}, {"slow"}}, values)
+}
+
+func TestWaitFirstNImpossible(t *testing.T) {
+	blocker := make(chan struct{})
+	defer close(blocker)
+	fail := func(msg string) error {
+		return errors.New(msg)
+	}
+	_, _, err := WaitFirstN(2, []*Promise{
+		New(func() {
+			<-blocker
+		}),
+		New(fail, "first"),
+		New(func() error {
+			time.Sleep(10 * time.Millisecond)
+			return fail("second")
+		}),
+	})
+	require.EqualError(t, err, "too many promises failed, last was promise 2: second")
+
+	requirePanicsWithError(t, "WaitFirstN requires between 0 and 1 successes, got 2", func() {
+		WaitFirstN(2, []*Promise{New(func() {})})
+	})
+	indices, values, err := WaitFirstN(0, nil)
+	require.NoError(t, err)
+	require.Empty(t, indices)
+	require.Empty(t, values)
+}